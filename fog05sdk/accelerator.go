@@ -0,0 +1,383 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	//GPU is GPU accelerator type
+	GPU string = "GPU"
+
+	//FPGA is FPGA accelerator type
+	FPGA string = "FPGA"
+
+	//AcceleratorsKey is the key of the assigned accelerators in FDURecord.HypervisorInfo
+	AcceleratorsKey string = "accelerators"
+)
+
+// acceleratorLibraries are the libraries supported by the accelerators using the given kernel driver
+var acceleratorLibraries = map[string][]string{
+	"nvidia":  {"cuda", "opencl", "vulkan"},
+	"amdgpu":  {"rocm", "opencl", "vulkan"},
+	"radeon":  {"opencl"},
+	"i915":    {"level_zero", "opencl", "vulkan"},
+	"xe":      {"level_zero", "opencl", "vulkan"},
+	"nouveau": {"vulkan"},
+	"fpga":    {"opencl"},
+}
+
+// AcceleratorSource discovers the accelerators of a node
+type AcceleratorSource interface {
+	Accelerators() ([]AcceleratorSpec, error)
+}
+
+// SysfsAcceleratorSource discovers the GPUs from the DRM class and the FPGAs from the FPGA manager class of sysfs
+type SysfsAcceleratorSource struct {
+	// Root is the directory containing sys, it is / on a node and a fixture directory in tests
+	Root string
+}
+
+// NewSysfsAcceleratorSource returns a sysfs source reading from the given root, an empty root means /
+func NewSysfsAcceleratorSource(root string) *SysfsAcceleratorSource {
+	if root == "" {
+		root = "/"
+	}
+	return &SysfsAcceleratorSource{Root: root}
+}
+
+// Accelerators returns the GPUs and the FPGAs found in sysfs, all available
+func (s *SysfsAcceleratorSource) Accelerators() ([]AcceleratorSpec, error) {
+	res := []AcceleratorSpec{}
+	gpus, err := s.scan(filepath.Join(s.Root, "sys", "class", "drm"), GPU)
+	if err != nil {
+		return nil, err
+	}
+	res = append(res, gpus...)
+	fpgas, err := s.scan(filepath.Join(s.Root, "sys", "class", "fpga_manager"), FPGA)
+	if err != nil {
+		return nil, err
+	}
+	return append(res, fpgas...), nil
+}
+
+// scan reads the devices of a sysfs class, the connectors of the DRM cards (eg. card0-HDMI-A-1) and the render nodes are skipped
+func (s *SysfsAcceleratorSource) scan(class string, kind string) ([]AcceleratorSpec, error) {
+	entries, err := ioutil.ReadDir(class)
+	if err != nil {
+		return []AcceleratorSpec{}, nil
+	}
+	res := []AcceleratorSpec{}
+	for _, e := range entries {
+		name := e.Name()
+		if kind == GPU && (!strings.HasPrefix(name, "card") || strings.Contains(name, "-")) {
+			continue
+		}
+		uevent := readUevent(filepath.Join(class, name, "device", "uevent"))
+		acc := AcceleratorSpec{HWAddress: name, Name: name, Type: kind, SupportedLibrary: []string{}, Available: true}
+		if addr, found := uevent["PCI_SLOT_NAME"]; found {
+			acc.HWAddress = addr
+		} else if addr, found := uevent["OF_FULLNAME"]; found {
+			acc.HWAddress = addr
+		}
+		if data, err := ioutil.ReadFile(filepath.Join(class, name, "name")); err == nil {
+			acc.Name = strings.TrimSpace(string(data))
+		}
+		driver := uevent["DRIVER"]
+		if kind == FPGA {
+			driver = "fpga"
+		}
+		if libs, found := acceleratorLibraries[driver]; found {
+			acc.SupportedLibrary = append(acc.SupportedLibrary, libs...)
+		}
+		res = append(res, acc)
+	}
+	return res, nil
+}
+
+// readUevent returns the KEY=VALUE pairs of a uevent file, an unreadable file has no pairs
+func readUevent(path string) map[string]string {
+	res := map[string]string{}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return res
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		kv := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(kv) == 2 {
+			res[kv[0]] = kv[1]
+		}
+	}
+	return res
+}
+
+// AcceleratorManager assigns the accelerators of a node to the instances according to their
+// GPU and FPGA requirements, and keeps their availability in the node information.
+// The availability is read from and written to the node information device by device,
+// so that managers of different plugins of the same node share the accelerators.
+// Once restored from the plugin state, the assignments are saved in it
+type AcceleratorManager struct {
+	connector   *YaksConnector
+	node        string
+	source      AcceleratorSource
+	mutex       sync.Mutex
+	devices     []AcceleratorSpec
+	assignments map[string][]string
+	state       *StateStore
+}
+
+// NewAcceleratorManager returns an accelerator manager for the given node discovering the accelerators from source
+func NewAcceleratorManager(connector *YaksConnector, nodeid string, source AcceleratorSource) *AcceleratorManager {
+	return &AcceleratorManager{connector: connector, node: nodeid, source: source, devices: []AcceleratorSpec{}, assignments: map[string][]string{}}
+}
+
+// Restore rebuilds the assignments saved in the plugin state, the following assignments are saved in it
+func (am *AcceleratorManager) Restore(state *StateStore) error {
+	rec, err := state.Record()
+	if err != nil {
+		return err
+	}
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+	am.state = state
+	for id, addrs := range rec.Accelerators {
+		am.assignments[id] = addrs
+		am.setAvailable(addrs, false)
+	}
+	return nil
+}
+
+// Discover reads the accelerators from the source and publishes them in the node information,
+// the ones assigned to an instance are not available, the availability of the ones already published is kept
+func (am *AcceleratorManager) Discover() ([]AcceleratorSpec, error) {
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+	devices, err := am.source.Accelerators()
+	if err != nil {
+		return nil, &FError{"Unable to discover accelerators", err}
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].HWAddress < devices[j].HWAddress })
+	am.devices = devices
+	err = am.publish()
+	if err != nil {
+		return nil, err
+	}
+	return append([]AcceleratorSpec{}, am.devices...), nil
+}
+
+// Assign assigns to the instance GPUMinCount GPUs and FPGAMinCount FPGAs supporting all the AcceleratorLibraries
+// of its computational requirements, the assigned accelerators are set in the hypervisor info of the record.
+// Only the accelerators available in the node information are assigned.
+// Either all the accelerators are assigned or none, assigning an instance again returns its accelerators
+func (am *AcceleratorManager) Assign(record *FDURecord) ([]AcceleratorSpec, error) {
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+
+	if _, found := am.assignments[record.UUID]; !found {
+		req := record.ComputationRequirements
+		needed := map[string]int{}
+		if req.GPUMinCount != nil {
+			needed[GPU] = *req.GPUMinCount
+		}
+		if req.FPGAMinCount != nil {
+			needed[FPGA] = *req.FPGAMinCount
+		}
+		assigned := []string{}
+		err := updateNodeInformation(am.connector, am.node, func(node *NodeInfo) error {
+			available := am.merge(node)
+			for _, kind := range []string{GPU, FPGA} {
+				count := 0
+				for _, acc := range am.devices {
+					if count == needed[kind] {
+						break
+					}
+					if acc.Type != kind || !available[acc.HWAddress] || !supportsLibraries(acc, req.AcceleratorLibraries) {
+						continue
+					}
+					assigned = append(assigned, acc.HWAddress)
+					count++
+				}
+				if count < needed[kind] {
+					return &FError{fmt.Sprintf("Not enough %s for instance %s, needed %d found %d", kind, record.UUID, needed[kind], count), nil}
+				}
+			}
+			setAvailability(node, assigned, false)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		am.assignments[record.UUID] = assigned
+		am.setAvailable(assigned, false)
+		am.save(record.UUID, assigned)
+	}
+
+	res := am.assigned(record.UUID)
+	if len(res) > 0 {
+		if record.HypervisorInfo == nil {
+			record.HypervisorInfo = &jsont{}
+		}
+		(*record.HypervisorInfo)[AcceleratorsKey] = res
+	}
+	return res, nil
+}
+
+// Release makes the accelerators assigned to the instance available again
+func (am *AcceleratorManager) Release(instanceid string) error {
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+	addrs, found := am.assignments[instanceid]
+	if !found {
+		return nil
+	}
+	err := updateNodeInformation(am.connector, am.node, func(node *NodeInfo) error {
+		am.merge(node)
+		setAvailability(node, addrs, true)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	delete(am.assignments, instanceid)
+	am.setAvailable(addrs, true)
+	am.save(instanceid, nil)
+	return nil
+}
+
+// save saves the assignments of the instance in the plugin state, nil assignments are removed from it,
+// a failure is logged since the accelerators are already assigned in the node
+func (am *AcceleratorManager) save(instanceid string, addrs []string) {
+	if am.state == nil {
+		return
+	}
+	err := am.state.Update(func(rec *PluginStateRecord) error {
+		if rec.Accelerators == nil {
+			rec.Accelerators = map[string][]string{}
+		}
+		if addrs == nil {
+			delete(rec.Accelerators, instanceid)
+		} else {
+			rec.Accelerators[instanceid] = addrs
+		}
+		return nil
+	})
+	if err != nil {
+		am.connector.Logger().WithField("instance", instanceid).Error("Unable to save accelerator assignment: " + err.Error())
+	}
+}
+
+// Assigned returns the accelerators assigned to the instance
+func (am *AcceleratorManager) Assigned(instanceid string) []AcceleratorSpec {
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+	return am.assigned(instanceid)
+}
+
+func (am *AcceleratorManager) assigned(instanceid string) []AcceleratorSpec {
+	res := []AcceleratorSpec{}
+	for _, acc := range am.devices {
+		if contains(am.assignments[instanceid], acc.HWAddress) {
+			res = append(res, acc)
+		}
+	}
+	return res
+}
+
+// used returns the accelerators assigned by the manager
+func (am *AcceleratorManager) used() map[string]bool {
+	used := map[string]bool{}
+	for _, addrs := range am.assignments {
+		for _, addr := range addrs {
+			used[addr] = true
+		}
+	}
+	return used
+}
+
+// merge adds to the node information the discovered accelerators not published yet, the ones assigned
+// by the manager are not available, and returns the availability of the accelerators in the node information
+func (am *AcceleratorManager) merge(node *NodeInfo) map[string]bool {
+	used := am.used()
+	available := map[string]bool{}
+	for _, acc := range node.Accelerator {
+		available[acc.HWAddress] = acc.Available
+	}
+	for _, acc := range am.devices {
+		if _, found := available[acc.HWAddress]; !found {
+			acc.Available = !used[acc.HWAddress]
+			node.Accelerator = append(node.Accelerator, acc)
+			available[acc.HWAddress] = acc.Available
+		}
+	}
+	for i := range node.Accelerator {
+		if used[node.Accelerator[i].HWAddress] {
+			node.Accelerator[i].Available = false
+			available[node.Accelerator[i].HWAddress] = false
+		}
+	}
+	return available
+}
+
+// publish merges the accelerators in the node information and updates their availability from it
+func (am *AcceleratorManager) publish() error {
+	var available map[string]bool
+	err := updateNodeInformation(am.connector, am.node, func(node *NodeInfo) error {
+		available = am.merge(node)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i := range am.devices {
+		am.devices[i].Available = available[am.devices[i].HWAddress]
+	}
+	return nil
+}
+
+// setAvailable sets the availability of the given accelerators of the manager
+func (am *AcceleratorManager) setAvailable(addrs []string, available bool) {
+	for i := range am.devices {
+		if contains(addrs, am.devices[i].HWAddress) {
+			am.devices[i].Available = available
+		}
+	}
+}
+
+// setAvailability sets the availability of the given accelerators in the node information
+func setAvailability(node *NodeInfo, addrs []string, available bool) {
+	for i := range node.Accelerator {
+		if contains(addrs, node.Accelerator[i].HWAddress) {
+			node.Accelerator[i].Available = available
+		}
+	}
+}
+
+func supportsLibraries(acc AcceleratorSpec, libraries []string) bool {
+	for _, lib := range libraries {
+		found := false
+		for _, l := range acc.SupportedLibrary {
+			found = found || strings.EqualFold(l, lib)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeFixture creates a fixture directory with the given files, the keys are paths relative to the directory
+func writeFixture(t *testing.T, files map[string]string) string {
+	root, err := ioutil.TempDir("", "fos-fixture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestSysfsAcceleratorSource(t *testing.T) {
+	root := writeFixture(t, map[string]string{
+		"sys/class/drm/card0/device/uevent":          "DRIVER=nvidia\nPCI_SLOT_NAME=0000:01:00.0\n",
+		"sys/class/drm/card0-HDMI-A-1/status":        "connected\n",
+		"sys/class/drm/renderD128/device/uevent":     "DRIVER=nvidia\nPCI_SLOT_NAME=0000:01:00.0\n",
+		"sys/class/drm/card1/device/uevent":          "DRIVER=i915\nPCI_SLOT_NAME=0000:00:02.0\n",
+		"sys/class/fpga_manager/fpga0/name":          "Xilinx ZynqMP FPGA Manager\n",
+		"sys/class/fpga_manager/fpga0/device/uevent": "OF_FULLNAME=/firmware/zynqmp-firmware/pcap\n",
+	})
+	defer os.RemoveAll(root)
+
+	accs, err := NewSysfsAcceleratorSource(root).Accelerators()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []AcceleratorSpec{
+		{HWAddress: "0000:01:00.0", Name: "card0", Type: GPU, SupportedLibrary: []string{"cuda", "opencl", "vulkan"}, Available: true},
+		{HWAddress: "0000:00:02.0", Name: "card1", Type: GPU, SupportedLibrary: []string{"level_zero", "opencl", "vulkan"}, Available: true},
+		{HWAddress: "/firmware/zynqmp-firmware/pcap", Name: "Xilinx ZynqMP FPGA Manager", Type: FPGA, SupportedLibrary: []string{"opencl"}, Available: true},
+	}
+	if !reflect.DeepEqual(accs, expected) {
+		t.Fatalf("unexpected accelerators %+v", accs)
+	}
+}
+
+func TestSysfsAcceleratorSourceEmpty(t *testing.T) {
+	root := writeFixture(t, map[string]string{})
+	defer os.RemoveAll(root)
+
+	accs, err := NewSysfsAcceleratorSource(root).Accelerators()
+	if err != nil || len(accs) != 0 {
+		t.Fatalf("unexpected accelerators %+v %v", accs, err)
+	}
+}
+
+func TestAcceleratorManagerMerge(t *testing.T) {
+	devices := []AcceleratorSpec{
+		{HWAddress: "0000:01:00.0", Type: GPU, Available: true},
+		{HWAddress: "0000:02:00.0", Type: GPU, Available: true},
+	}
+	first := &AcceleratorManager{devices: devices, assignments: map[string][]string{"i1": {"0000:01:00.0"}}}
+	second := &AcceleratorManager{devices: devices, assignments: map[string][]string{}}
+
+	node := &NodeInfo{}
+	first.merge(node)
+	available := second.merge(node)
+	if len(node.Accelerator) != 2 {
+		t.Fatalf("accelerators published twice %+v", node.Accelerator)
+	}
+	if available["0000:01:00.0"] || !available["0000:02:00.0"] {
+		t.Fatalf("accelerator assigned by another manager available %+v", available)
+	}
+
+	// a release by a manager does not free the accelerators assigned by the others
+	setAvailability(node, second.assignments["i1"], true)
+	if second.merge(node)["0000:01:00.0"] {
+		t.Fatal("accelerator freed by a manager not owning it")
+	}
+}
@@ -0,0 +1,208 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/atolab/yaks-go"
+)
+
+// AuditPrefix constant for the audit log, records are stored in
+// /aufos/<tenant>/<node>/<fdu>/<timestamp>-<id> and never overwritten
+const AuditPrefix string = "/aufos"
+
+// auditAny is the path segment used for the tenant, node or FDU of a record that has none
+const auditAny string = "_"
+
+const (
+	// AUDITPUT is the operation of a write in a desired store
+	AUDITPUT string = "put"
+
+	// AUDITREMOVE is the operation of a removal from a desired store
+	AUDITREMOVE string = "remove"
+
+	// AUDITTRANSITION is the operation of an instance state transition handled by a runtime plugin
+	AUDITTRANSITION string = "transition"
+)
+
+// AuditRecord represents an entry of the audit log, the hashes are the SHA-256 of the values,
+// empty if there was no previous value or if the value was removed
+type AuditRecord struct {
+	ID           string `json:"id"`
+	Timestamp    int64  `json:"timestamp"`
+	Actor        string `json:"actor"`
+	Operation    string `json:"operation"`
+	Path         string `json:"path"`
+	PreviousHash string `json:"previous_hash,omitempty"`
+	NewHash      string `json:"new_hash,omitempty"`
+	Tenant       string `json:"tenant,omitempty"`
+	Node         string `json:"node,omitempty"`
+	FDU          string `json:"fdu,omitempty"`
+	Instance     string `json:"instance,omitempty"`
+	State        string `json:"state,omitempty"`
+}
+
+// AuditFilter selects the records of the audit log, empty fields and zero times match everything
+type AuditFilter struct {
+	Tenant string
+	Node   string
+	FDU    string
+	From   time.Time
+	To     time.Time
+}
+
+// Auditor records the writes in the desired stores done through a connector
+type Auditor struct {
+	ws    *yaksSession
+	actor string
+}
+
+// auditValueHash returns the SHA-256 of the value, or an empty string if there is no value
+func auditValueHash(v yaks.Value) string {
+	if v == nil {
+		return ""
+	}
+	h := sha256.Sum256([]byte(v.ToString()))
+	return hex.EncodeToString(h[:])
+}
+
+// isDesiredPath returns true if the path is in the global or local desired store
+func isDesiredPath(path string) bool {
+	for _, prefix := range []string{GlobalDesiredPrefix, LocalDesiredPrefix} {
+		if path == prefix || strings.HasPrefix(path, prefix+URISeparator) {
+			return true
+		}
+	}
+	return false
+}
+
+// newAuditRecord returns a record for the path, the tenant, node, FDU and instance are taken from the path
+func newAuditRecord(actor string, operation string, path string) AuditRecord {
+	rec := AuditRecord{ID: randomHex(8), Timestamp: time.Now().UnixNano(), Actor: actor, Operation: operation, Path: path}
+	tokens := strings.Split(strings.TrimPrefix(path, URISeparator), URISeparator)
+	if len(tokens) > 1 && URISeparator+tokens[0] == LocalDesiredPrefix {
+		rec.Node = tokens[1]
+	}
+	for i := 0; i+1 < len(tokens); i++ {
+		switch tokens[i] {
+		case "tenants":
+			rec.Tenant = tokens[i+1]
+		case "nodes":
+			rec.Node = tokens[i+1]
+		case "fdu":
+			rec.FDU = tokens[i+1]
+		case "instances":
+			rec.Instance = tokens[i+1]
+		}
+	}
+	return rec
+}
+
+// previous returns the value currently stored in the path
+func (a *Auditor) previous(path *yaks.Path) yaks.Value {
+	s, err := yaks.NewSelector(path.ToString())
+	if err != nil {
+		return nil
+	}
+	kvs := a.ws.workspace().Get(s)
+	if len(kvs) == 0 {
+		return nil
+	}
+	return kvs[0].Value()
+}
+
+// record appends the record to the audit log
+func (a *Auditor) record(rec AuditRecord) error {
+	v, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	p := CreatePath([]string{AuditPrefix, auditSegment(rec.Tenant), auditSegment(rec.Node), auditSegment(rec.FDU), fmt.Sprintf("%020d-%s", rec.Timestamp, rec.ID)})
+	return a.ws.Put(p, yaks.NewStringValue(string(v)))
+}
+
+// RecordTransition records the write of the record of an instance in the local actual store by a runtime plugin,
+// previous is the record in the local actual store before the write, nil if there is none.
+// A record with the UNDEFINE status is the removal of the record, it has no new hash
+func (a *Auditor) RecordTransition(nodeid string, pluginid string, previous *FDURecord, record FDURecord) error {
+	p := CreatePath([]string{LocalActualPrefix, nodeid, "runtimes", pluginid, "fdu", record.FDUID, "instances", record.UUID, "info"})
+	rec := newAuditRecord(a.actor, AUDITTRANSITION, p.ToString())
+	rec.Node = nodeid
+	rec.State = record.Status
+	if previous != nil {
+		if v, err := json.Marshal(previous); err == nil {
+			rec.PreviousHash = auditValueHash(yaks.NewStringValue(string(v)))
+		}
+	}
+	if v, err := json.Marshal(record); err == nil && record.Status != UNDEFINE {
+		rec.NewHash = auditValueHash(yaks.NewStringValue(string(v)))
+	}
+	return a.record(rec)
+}
+
+func auditSegment(s string) string {
+	if s == "" {
+		return auditAny
+	}
+	return s
+}
+
+// GetAuditRecords returns the records of the audit log matching the filter sorted by time
+func (yc *YaksConnector) GetAuditRecords(filter AuditFilter) ([]AuditRecord, error) {
+	segment := func(s string) string {
+		if s == "" {
+			return "*"
+		}
+		return s
+	}
+	s := CreateSelector([]string{AuditPrefix, segment(filter.Tenant), segment(filter.Node), segment(filter.FDU), "*"})
+	res := []AuditRecord{}
+	for _, kv := range yc.session.Get(s) {
+		rec := AuditRecord{}
+		err := json.Unmarshal([]byte(kv.Value().ToString()), &rec)
+		if err != nil {
+			return nil, err
+		}
+		if !filter.From.IsZero() && rec.Timestamp < filter.From.UnixNano() {
+			continue
+		}
+		if !filter.To.IsZero() && rec.Timestamp > filter.To.UnixNano() {
+			continue
+		}
+		res = append(res, rec)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Timestamp < res[j].Timestamp })
+	return res, nil
+}
+
+// EnableAudit starts recording the writes in the desired stores done through the connector, on behalf of actor
+func (yc *YaksConnector) EnableAudit(actor string) *Auditor {
+	a := &Auditor{ws: yc.session, actor: actor}
+	yc.session.mutex.Lock()
+	yc.session.auditor = a
+	yc.session.mutex.Unlock()
+	return a
+}
+
+// Auditor returns the auditor of the connector, nil if audit is not enabled
+func (yc *YaksConnector) Auditor() *Auditor {
+	return yc.session.audit()
+}
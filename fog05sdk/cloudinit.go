@@ -0,0 +1,167 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v2"
+)
+
+// CloudInitLabel is the volume label of a NoCloud seed image
+const CloudInitLabel = "cidata"
+
+// CloudInitTemplateHeader is the first line of the configuration scripts that are templates,
+// scripts without it are passed through untouched, eg. cloud-init jinja templates or shell scripts containing {{
+const CloudInitTemplateHeader = "## template: fog05"
+
+// CloudInitVars are the variables available in the templates of the configuration scripts,
+// eg. {{ .InstanceID }} or {{ index .Vars "key" }}
+type CloudInitVars struct {
+	InstanceID string
+	FDUID      string
+	NodeID     string
+	Hostname   string
+	Interfaces []FDUInterfaceRecord
+	Vars       map[string]string
+}
+
+// CloudInitData is the NoCloud seed data of an instance
+type CloudInitData struct {
+	UserData      []byte
+	MetaData      []byte
+	NetworkConfig []byte
+}
+
+// NewCloudInitVars returns the variables of the given instance, the hostname is the instance ID
+func NewCloudInitVars(record FDURecord, nodeid string) CloudInitVars {
+	vars := CloudInitVars{InstanceID: record.UUID, FDUID: record.FDUID, NodeID: nodeid, Hostname: record.UUID, Vars: map[string]string{}}
+	if record.Interfaces != nil {
+		vars.Interfaces = *record.Interfaces
+	}
+	return vars
+}
+
+// RenderCloudInit renders the NoCloud seed data of the instance: the user-data is the configuration script,
+// rendered as a template when it starts with CloudInitTemplateHeader, the meta-data contains the instance ID, the hostname and the SSH keys
+// and the network-config is generated from the instance interfaces
+func RenderCloudInit(record FDURecord, vars CloudInitVars) (*CloudInitData, error) {
+	if record.Configuration == nil {
+		return nil, &FError{"Instance " + record.UUID + " has no configuration", nil}
+	}
+	conf := record.Configuration
+
+	userData := conf.Script
+	if header, script := splitTemplateHeader(conf.Script); header {
+		var err error
+		userData, err = renderTemplate(script, vars)
+		if err != nil {
+			return nil, err
+		}
+	}
+	switch conf.ConfType {
+	case CLOUDINIT:
+	case SCRIPT:
+		if !strings.HasPrefix(userData, "#!") {
+			userData = "#!/bin/sh\n" + userData
+		}
+	default:
+		return nil, &FError{"Unsupported configuration type: " + conf.ConfType, nil}
+	}
+
+	meta := yaml.MapSlice{
+		{Key: "instance-id", Value: vars.InstanceID},
+		{Key: "local-hostname", Value: vars.Hostname},
+	}
+	if len(conf.SSHKeys) > 0 {
+		meta = append(meta, yaml.MapItem{Key: "public-keys", Value: conf.SSHKeys})
+	}
+	metaData, err := yaml.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	networkConfig, err := yaml.Marshal(renderNetworkConfig(vars.Interfaces))
+	if err != nil {
+		return nil, err
+	}
+	return &CloudInitData{UserData: []byte(userData), MetaData: metaData, NetworkConfig: networkConfig}, nil
+}
+
+// WriteISO writes the seed data in a NoCloud ISO9660 image
+func (cd *CloudInitData) WriteISO(path string) error {
+	files := map[string][]byte{"user-data": cd.UserData, "meta-data": cd.MetaData}
+	if len(cd.NetworkConfig) > 0 {
+		files["network-config"] = cd.NetworkConfig
+	}
+	err := writeISO9660(path, CloudInitLabel, files)
+	if err != nil {
+		return &FError{"Unable to write NoCloud image " + path, err}
+	}
+	return nil
+}
+
+// splitTemplateHeader returns whether the script starts with CloudInitTemplateHeader and the script without it
+func splitTemplateHeader(script string) (bool, string) {
+	line, rest := script, ""
+	if i := strings.Index(script, "\n"); i >= 0 {
+		line, rest = script[:i], script[i+1:]
+	}
+	if strings.TrimSpace(line) != CloudInitTemplateHeader {
+		return false, script
+	}
+	return true, rest
+}
+
+// renderTemplate renders the script as a text template with the given variables
+func renderTemplate(script string, vars CloudInitVars) (string, error) {
+	tmpl, err := template.New("configuration").Option("missingkey=error").Parse(script)
+	if err != nil {
+		return "", &FError{"Invalid configuration template", err}
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, vars)
+	if err != nil {
+		return "", &FError{"Unable to render configuration template", err}
+	}
+	return buf.String(), nil
+}
+
+// renderNetworkConfig returns a network configuration version 2, interfaces are matched by MAC address
+// when it is known and use DHCP, if there is a management interface it is the only one with the default route
+func renderNetworkConfig(interfaces []FDUInterfaceRecord) yaml.MapSlice {
+	mgmt := false
+	for _, intf := range interfaces {
+		mgmt = mgmt || intf.IsMGMT
+	}
+	ethernets := yaml.MapSlice{}
+	for _, intf := range interfaces {
+		cfg := yaml.MapSlice{}
+		if intf.MACAddress != nil && *intf.MACAddress != "" {
+			cfg = append(cfg, yaml.MapItem{Key: "match", Value: yaml.MapSlice{{Key: "macaddress", Value: strings.ToLower(*intf.MACAddress)}}})
+			cfg = append(cfg, yaml.MapItem{Key: "set-name", Value: intf.Name})
+		}
+		cfg = append(cfg, yaml.MapItem{Key: "dhcp4", Value: true})
+		if mgmt && !intf.IsMGMT {
+			cfg = append(cfg, yaml.MapItem{Key: "dhcp4-overrides", Value: yaml.MapSlice{{Key: "use-routes", Value: false}}})
+		}
+		ethernets = append(ethernets, yaml.MapItem{Key: intf.Name, Value: cfg})
+	}
+	return yaml.MapSlice{
+		{Key: "version", Value: 2},
+		{Key: "ethernets", Value: ethernets},
+	}
+}
@@ -0,0 +1,138 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestRenderCloudInitPassThrough(t *testing.T) {
+	scripts := []string{
+		"## template: jinja\n#cloud-config\nhostname: {{ v1.instance_id }}\n",
+		"#!/bin/sh\ndocker ps --format '{{.Names}}'\n",
+	}
+	for _, script := range scripts {
+		record := FDURecord{UUID: "inst", Configuration: &FDUConfiguration{ConfType: CLOUDINIT, Script: script}}
+		data, err := RenderCloudInit(record, NewCloudInitVars(record, "node"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data.UserData) != script {
+			t.Fatalf("script changed to %q", data.UserData)
+		}
+	}
+}
+
+func TestRenderCloudInitTemplate(t *testing.T) {
+	script := CloudInitTemplateHeader + "\necho {{ .InstanceID }} {{ index .Vars \"key\" }}\n"
+	record := FDURecord{UUID: "inst", Configuration: &FDUConfiguration{ConfType: SCRIPT, Script: script}}
+	vars := NewCloudInitVars(record, "node")
+	vars.Vars["key"] = "value"
+	data, err := RenderCloudInit(record, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data.UserData) != "#!/bin/sh\necho inst value\n" {
+		t.Fatalf("unexpected user-data %q", data.UserData)
+	}
+	if !bytes.Contains(data.MetaData, []byte("instance-id: inst")) {
+		t.Fatalf("unexpected meta-data %q", data.MetaData)
+	}
+
+	record.Configuration.Script = CloudInitTemplateHeader + "\n{{ .Missing }}"
+	if _, err := RenderCloudInit(record, vars); err == nil {
+		t.Fatal("template with an unknown variable rendered")
+	}
+}
+
+func TestWriteISO(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "fos-iso")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	files := map[string][]byte{
+		"user-data":      []byte("#cloud-config\n"),
+		"meta-data":      []byte("instance-id: inst\n"),
+		"network-config": bytes.Repeat([]byte("x"), isoSectorSize+1),
+	}
+	path := filepath.Join(tmp, "seed.iso")
+	if err := writeISO9660(path, CloudInitLabel, files); err != nil {
+		t.Fatal(err)
+	}
+	img, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sector := func(n uint32) []byte {
+		return img[int(n)*isoSectorSize : int(n+1)*isoSectorSize]
+	}
+
+	pvd := sector(16)
+	if pvd[0] != 1 || string(pvd[1:6]) != "CD001" {
+		t.Fatal("missing primary volume descriptor")
+	}
+	if label := strings.TrimRight(string(pvd[40:72]), " "); label != "CIDATA" {
+		t.Fatalf("unexpected primary volume label %q", label)
+	}
+	if blocks := binary.LittleEndian.Uint32(pvd[80:84]); int(blocks)*isoSectorSize != len(img) {
+		t.Fatalf("volume size %d does not match the image size %d", blocks, len(img))
+	}
+
+	svd := sector(17)
+	if svd[0] != 2 || string(svd[1:6]) != "CD001" || string(svd[88:91]) != "%/E" {
+		t.Fatal("missing Joliet volume descriptor")
+	}
+	if label := strings.TrimRight(decodeUCS2(svd[40:72]), " "); label != CloudInitLabel {
+		t.Fatalf("unexpected Joliet volume label %q", label)
+	}
+
+	root := binary.LittleEndian.Uint32(svd[156+2 : 156+6])
+	dir := sector(root)
+	found := map[string][]byte{}
+	for off := 0; off < len(dir) && dir[off] != 0; off += int(dir[off]) {
+		rec := dir[off : off+int(dir[off])]
+		id := rec[33 : 33+int(rec[32])]
+		if rec[25]&2 != 0 {
+			continue
+		}
+		extent := binary.LittleEndian.Uint32(rec[2:6])
+		size := binary.LittleEndian.Uint32(rec[10:14])
+		start := int(extent) * isoSectorSize
+		found[decodeUCS2(id)] = img[start : start+int(size)]
+	}
+	if len(found) != len(files) {
+		t.Fatalf("expected %d files, found %d", len(files), len(found))
+	}
+	for name, data := range files {
+		if !bytes.Equal(found[name], data) {
+			t.Fatalf("unexpected content of %s", name)
+		}
+	}
+}
+
+func decodeUCS2(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.BigEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u))
+}
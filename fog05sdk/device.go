@@ -0,0 +1,213 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DeviceAllocation represents the IO devices allocated to an instance for one of its IO ports
+type DeviceAllocation struct {
+	Port    FDUIOPort `json:"port"`
+	Devices []IOSpec  `json:"devices"`
+}
+
+// DeviceAllocator allocates the IO devices of a node to the instances according to their FDUIOPort requirements,
+// allocated devices are marked as not available in the node information.
+// Once restored from the plugin state, the allocations are saved in it
+type DeviceAllocator struct {
+	connector   *YaksConnector
+	node        string
+	mutex       sync.Mutex
+	owners      map[string]string
+	allocations map[string][]DeviceAllocation
+	state       *StateStore
+}
+
+// NewDeviceAllocator returns a device allocator for the IO devices of the given node
+func NewDeviceAllocator(connector *YaksConnector, nodeid string) *DeviceAllocator {
+	return &DeviceAllocator{connector: connector, node: nodeid, owners: map[string]string{}, allocations: map[string][]DeviceAllocation{}}
+}
+
+// Restore rebuilds the allocations saved in the plugin state, the following allocations are saved in it
+func (da *DeviceAllocator) Restore(state *StateStore) error {
+	rec, err := state.Record()
+	if err != nil {
+		return err
+	}
+	da.mutex.Lock()
+	defer da.mutex.Unlock()
+	da.state = state
+	for id, allocs := range rec.Devices {
+		da.allocations[id] = allocs
+		for _, alloc := range allocs {
+			for _, dev := range alloc.Devices {
+				da.owners[dev.Name] = id
+			}
+		}
+	}
+	return nil
+}
+
+// Allocate claims, for each IO port of the instance, at least MinIOPorts available devices of the port kind,
+// if the port has an address only the device with that name or file is claimed.
+// Either all the ports are allocated or none, allocating an instance again returns its allocation
+func (da *DeviceAllocator) Allocate(record FDURecord) ([]DeviceAllocation, error) {
+	da.mutex.Lock()
+	defer da.mutex.Unlock()
+
+	if allocs, found := da.allocations[record.UUID]; found {
+		return allocs, nil
+	}
+	if len(record.IOPorts) == 0 {
+		return []DeviceAllocation{}, nil
+	}
+
+	allocs := []DeviceAllocation{}
+	err := updateNodeInformation(da.connector, da.node, func(node *NodeInfo) error {
+		claimed := map[int]bool{}
+		for _, port := range record.IOPorts {
+			needed := port.MinIOPorts
+			if needed <= 0 {
+				needed = 1
+			}
+			alloc := DeviceAllocation{Port: port, Devices: []IOSpec{}}
+			busy := []string{}
+			for i, dev := range node.IO {
+				if !deviceMatches(dev, port) || claimed[i] {
+					continue
+				}
+				if owner, found := da.owners[dev.Name]; found || !dev.Available {
+					if found {
+						busy = append(busy, fmt.Sprintf("%s used by %s", dev.Name, owner))
+					} else {
+						busy = append(busy, dev.Name+" not available")
+					}
+					continue
+				}
+				if len(alloc.Devices) < needed {
+					alloc.Devices = append(alloc.Devices, dev)
+					claimed[i] = true
+				}
+			}
+			if len(alloc.Devices) < needed {
+				msg := fmt.Sprintf("Not enough %s devices for instance %s, needed %d found %d", port.IOKind, record.UUID, needed, len(alloc.Devices))
+				if len(busy) > 0 {
+					msg = msg + " (" + strings.Join(busy, ", ") + ")"
+				}
+				return &FError{msg, nil}
+			}
+			allocs = append(allocs, alloc)
+		}
+		for i := range claimed {
+			node.IO[i].Available = false
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, alloc := range allocs {
+		for _, dev := range alloc.Devices {
+			da.owners[dev.Name] = record.UUID
+		}
+	}
+	da.allocations[record.UUID] = allocs
+	da.save(record.UUID, allocs)
+	return allocs, nil
+}
+
+// Release releases the devices allocated to the instance and marks them as available
+func (da *DeviceAllocator) Release(instanceid string) error {
+	da.mutex.Lock()
+	defer da.mutex.Unlock()
+
+	allocs, found := da.allocations[instanceid]
+	if !found {
+		return nil
+	}
+	err := updateNodeInformation(da.connector, da.node, func(node *NodeInfo) error {
+		for i, dev := range node.IO {
+			if da.owners[dev.Name] == instanceid {
+				node.IO[i].Available = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, alloc := range allocs {
+		for _, dev := range alloc.Devices {
+			delete(da.owners, dev.Name)
+		}
+	}
+	delete(da.allocations, instanceid)
+	da.save(instanceid, nil)
+	return nil
+}
+
+// save saves the allocations of the instance in the plugin state, nil allocations are removed from it,
+// a failure is logged since the devices are already allocated in the node
+func (da *DeviceAllocator) save(instanceid string, allocs []DeviceAllocation) {
+	if da.state == nil {
+		return
+	}
+	err := da.state.Update(func(rec *PluginStateRecord) error {
+		if rec.Devices == nil {
+			rec.Devices = map[string][]DeviceAllocation{}
+		}
+		if allocs == nil {
+			delete(rec.Devices, instanceid)
+		} else {
+			rec.Devices[instanceid] = allocs
+		}
+		return nil
+	})
+	if err != nil {
+		da.connector.Logger().WithField("instance", instanceid).Error("Unable to save device allocation: " + err.Error())
+	}
+}
+
+// Devices returns the paths of the devices allocated to the instance, sorted
+func (da *DeviceAllocator) Devices(instanceid string) []string {
+	da.mutex.Lock()
+	defer da.mutex.Unlock()
+	res := []string{}
+	for _, alloc := range da.allocations[instanceid] {
+		for _, dev := range alloc.Devices {
+			res = append(res, dev.IOFile)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Owner returns the instance the device is allocated to
+func (da *DeviceAllocator) Owner(device string) (string, bool) {
+	da.mutex.Lock()
+	defer da.mutex.Unlock()
+	owner, found := da.owners[device]
+	return owner, found
+}
+
+func deviceMatches(dev IOSpec, port FDUIOPort) bool {
+	if !strings.EqualFold(dev.IOType, port.IOKind) {
+		return false
+	}
+	return port.Address == "" || port.Address == dev.Name || port.Address == dev.IOFile
+}
@@ -0,0 +1,245 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/atolab/yaks-go"
+)
+
+const (
+	// OSPLUGIN is the OS plugin type
+	OSPLUGIN string = "os"
+
+	// NETWORKPLUGIN is the network manager plugin type
+	NETWORKPLUGIN string = "network"
+
+	// RUNTIMEPLUGIN is the runtime plugin type
+	RUNTIMEPLUGIN string = "runtime"
+
+	// AGENTPLUGIN is the agent type
+	AGENTPLUGIN string = "agent"
+)
+
+type dependencyWatcher struct {
+	requirements []string
+	listener     func(string, Plugin)
+}
+
+// PluginDiscovery keeps track of the plugins running in a node and resolves them by type or name
+type PluginDiscovery struct {
+	connector *YaksConnector
+	node      string
+	mutex     sync.Mutex
+	plugins   map[string]Plugin
+	changed   chan bool
+	watchers  []*dependencyWatcher
+	sid       *yaks.SubscriptionID
+}
+
+// NewPluginDiscovery returns a new PluginDiscovery observing the plugins of the given node
+func NewPluginDiscovery(connector *YaksConnector, nodeid string) (*PluginDiscovery, error) {
+	pd := &PluginDiscovery{connector: connector, node: nodeid, plugins: map[string]Plugin{}, changed: make(chan bool), watchers: []*dependencyWatcher{}}
+
+	sid, err := connector.Local.Actual.ObserveNodePluginsChanges(nodeid, pd.update)
+	if err != nil {
+		return nil, err
+	}
+	pd.sid = sid
+
+	pids, err := connector.Local.Actual.GetAllPlugins(nodeid)
+	if err != nil {
+		pd.Close()
+		return nil, err
+	}
+	for _, pid := range pids {
+		pl, err := connector.Local.Actual.GetNodePlugin(nodeid, pid)
+		if err != nil {
+			continue
+		}
+		pd.update(pid, pl, false)
+	}
+	return pd, nil
+}
+
+// Close stops observing the plugins of the node
+func (pd *PluginDiscovery) Close() error {
+	return pd.connector.Local.Actual.Unsubscribe(pd.sid)
+}
+
+// Find returns the plugins matching the given requirement, a requirement is a plugin type, name or UUID
+// optionally followed by a version constraint, eg. os>=2
+func (pd *PluginDiscovery) Find(requirement string) []Plugin {
+	pd.mutex.Lock()
+	defer pd.mutex.Unlock()
+	return pd.candidates(requirement)
+}
+
+// Resolve returns, for each requirement, a plugin matching it whose own requirements are also satisfied
+func (pd *PluginDiscovery) Resolve(requirements []string) (map[string]Plugin, error) {
+	pd.mutex.Lock()
+	defer pd.mutex.Unlock()
+	return pd.resolve(requirements)
+}
+
+// Wait waits until all the requirements can be resolved or the context is done
+func (pd *PluginDiscovery) Wait(ctx context.Context, requirements []string) (map[string]Plugin, error) {
+	for {
+		pd.mutex.Lock()
+		res, err := pd.resolve(requirements)
+		ch := pd.changed
+		pd.mutex.Unlock()
+		if err == nil {
+			return res, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, &FError{"Dependencies not available: " + ctx.Err().Error(), err}
+		case <-ch:
+		}
+	}
+}
+
+// Watch registers a listener called with the requirement and the removed plugin
+// each time one of the requirements can no longer be resolved because a plugin disappeared
+func (pd *PluginDiscovery) Watch(requirements []string, listener func(string, Plugin)) {
+	pd.mutex.Lock()
+	defer pd.mutex.Unlock()
+	pd.watchers = append(pd.watchers, &dependencyWatcher{requirements: requirements, listener: listener})
+}
+
+func (pd *PluginDiscovery) update(pid string, info *Plugin, removed bool) {
+	type lost struct {
+		requirement string
+		listener    func(string, Plugin)
+	}
+	notifications := []lost{}
+
+	pd.mutex.Lock()
+	old, found := pd.plugins[pid]
+	if removed {
+		before := pd.satisfied()
+		delete(pd.plugins, pid)
+		after := pd.satisfied()
+		for w, reqs := range before {
+			for _, r := range reqs {
+				if !contains(after[w], r) {
+					notifications = append(notifications, lost{r, w.listener})
+				}
+			}
+		}
+	} else {
+		pd.plugins[pid] = *info
+	}
+	close(pd.changed)
+	pd.changed = make(chan bool)
+	pd.mutex.Unlock()
+
+	if !found {
+		return
+	}
+	for _, n := range notifications {
+		n.listener(n.requirement, old)
+	}
+}
+
+// satisfied returns, for each watcher, the requirements that can be resolved
+func (pd *PluginDiscovery) satisfied() map[*dependencyWatcher][]string {
+	res := map[*dependencyWatcher][]string{}
+	for _, w := range pd.watchers {
+		res[w] = []string{}
+		for _, r := range w.requirements {
+			_, err := pd.resolve([]string{r})
+			if err == nil {
+				res[w] = append(res[w], r)
+			}
+		}
+	}
+	return res
+}
+
+func (pd *PluginDiscovery) candidates(requirement string) []Plugin {
+	res := []Plugin{}
+	for _, pl := range pd.plugins {
+		if pluginMatches(pl, requirement) {
+			res = append(res, pl)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].UUID < res[j].UUID })
+	return res
+}
+
+func (pd *PluginDiscovery) resolve(requirements []string) (map[string]Plugin, error) {
+	res := map[string]Plugin{}
+	for _, r := range requirements {
+		pl, err := pd.resolveRequirement(r, []string{})
+		if err != nil {
+			return nil, err
+		}
+		res[r] = *pl
+	}
+	return res, nil
+}
+
+// resolveRequirement finds a plugin for the requirement walking its dependency graph,
+// path contains the UUIDs of the plugins already visited and is used to detect cycles
+func (pd *PluginDiscovery) resolveRequirement(requirement string, path []string) (*Plugin, error) {
+	cands := pd.candidates(requirement)
+	if len(cands) == 0 {
+		return nil, &FError{"Requirement not satisfied: " + requirement, nil}
+	}
+	var lastErr error
+	for _, pl := range cands {
+		visited := append(append([]string{}, path...), pl.UUID)
+		if contains(path, pl.UUID) {
+			lastErr = &FError{"Dependency cycle detected: " + strings.Join(visited, " -> "), nil}
+			continue
+		}
+		ok := true
+		for _, dep := range pl.Requirements {
+			_, err := pd.resolveRequirement(dep, visited)
+			if err != nil {
+				lastErr = err
+				ok = false
+				break
+			}
+		}
+		if ok {
+			found := pl
+			return &found, nil
+		}
+	}
+	return nil, &FError{"Requirement not satisfied: " + requirement, lastErr}
+}
+
+func pluginMatches(pl Plugin, requirement string) bool {
+	r, err := ParseRequirement(requirement)
+	if err != nil {
+		return false
+	}
+	return r.Matches(pl)
+}
+
+func contains(slice []string, s string) bool {
+	for _, e := range slice {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
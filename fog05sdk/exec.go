@@ -0,0 +1,292 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"context"
+	b64 "encoding/base64"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/atolab/yaks-go"
+)
+
+// ExecOutputGracePeriod is how long the output of a process is still sent after it exits,
+// a child process keeping the output open does not keep the session open past it
+const ExecOutputGracePeriod = 5 * time.Second
+
+// ExecProcess is a process started by a runtime plugin inside an FDU instance by ExecFDU or AttachFDU
+type ExecProcess interface {
+
+	//Stdin returns the standard input of the process
+	Stdin() io.WriteCloser
+
+	//Stdout returns the output of the process, with a TTY it contains also the standard error.
+	//It is closed when the client stops reading the output, closing it has to unblock a pending read
+	Stdout() io.ReadCloser
+
+	//Resize resizes the TTY of the process, it is ignored if the process has no TTY
+	Resize(rows int, cols int) error
+
+	//Wait waits for the process to exit and returns its exit code
+	Wait() (int, error)
+
+	//Kill terminates the process
+	Kill() error
+}
+
+// An exec session is stored under its path as:
+//   <path>/in the standard input, as a chunked transfer written by the client
+//   <path>/out the output, as a chunked transfer written by the plugin
+//   <path>/resize the ExecTerminalSize written by the client
+//   <path>/close written by the client to terminate the process
+//   <path>/exit the ExecExit written by the plugin when the process exits
+
+func encodeExecRequest(req ExecRequest) (string, error) {
+	v, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	return b64.RawURLEncoding.EncodeToString(v), nil
+}
+
+func decodeExecRequest(s string) (*ExecRequest, error) {
+	v, err := b64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, &FError{"Invalid exec request", err}
+	}
+	req := ExecRequest{}
+	err = json.Unmarshal(v, &req)
+	if err != nil {
+		return nil, &FError{"Invalid exec request", err}
+	}
+	return &req, nil
+}
+
+// serveExecSession connects the process to the session stored under path until the process exits
+func serveExecSession(ws *yaksSession, path string, id string, proc ExecProcess) error {
+	resizeSid, err := ws.Subscribe(CreateSelector([]string{path, "resize"}), func(changes []yaks.Change) {
+		for _, c := range changes {
+			if c.Kind() == yaks.REMOVE {
+				continue
+			}
+			size := ExecTerminalSize{}
+			if json.Unmarshal([]byte(c.Value().ToString()), &size) == nil {
+				proc.Resize(size.Rows, size.Cols)
+			}
+		}
+	})
+	if err != nil {
+		proc.Kill()
+		return err
+	}
+	defer ws.Unsubscribe(resizeSid)
+
+	closeSid, err := ws.Subscribe(CreateSelector([]string{path, "close"}), func(changes []yaks.Change) {
+		for _, c := range changes {
+			if c.Kind() != yaks.REMOVE {
+				proc.Kill()
+			}
+		}
+	})
+	if err != nil {
+		proc.Kill()
+		return err
+	}
+	defer ws.Unsubscribe(closeSid)
+
+	in, err := newTransferReader(ws, path+URISeparator+"in")
+	if err != nil {
+		proc.Kill()
+		return err
+	}
+	go func() {
+		stdin := proc.Stdin()
+		io.Copy(stdin, in)
+		stdin.Close()
+	}()
+
+	stdout := &execOutput{ReadCloser: proc.Stdout()}
+	out := make(chan error, 1)
+	go func() {
+		out <- sendTransfer(ws, path+URISeparator+"out", id, stdout)
+	}()
+
+	code, werr := proc.Wait()
+	// the output is completed when the process exits, waiting for it ensures that the client
+	// receives the whole output before the exit status. The output stays open if a child of the process
+	// inherited it, it is then closed after ExecOutputGracePeriod
+	var oerr error
+	select {
+	case oerr = <-out:
+	case <-time.After(ExecOutputGracePeriod):
+		stdout.stop()
+		oerr = <-out
+	}
+	in.Close()
+
+	exit := ExecExit{ExitCode: code}
+	if werr != nil {
+		msg := werr.Error()
+		exit.Error = &msg
+	}
+	v, err := json.Marshal(exit)
+	if err != nil {
+		return err
+	}
+	err = ws.Put(CreatePath([]string{path, "exit"}), yaks.NewStringValue(string(v)))
+	if err != nil {
+		return err
+	}
+	if werr != nil {
+		return werr
+	}
+	return oerr
+}
+
+// execOutput is the output of a process, once stopped it is closed and the read error is io.EOF,
+// so that the transfer completes with the output read until then
+type execOutput struct {
+	io.ReadCloser
+	stopped int32
+}
+
+func (o *execOutput) Read(p []byte) (int, error) {
+	n, err := o.ReadCloser.Read(p)
+	if err != nil && atomic.LoadInt32(&o.stopped) == 1 {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (o *execOutput) stop() {
+	atomic.StoreInt32(&o.stopped, 1)
+	o.ReadCloser.Close()
+}
+
+// ExecSession is the client side of an exec or attach session, reads return the output of the process
+// and writes are sent to its standard input
+type ExecSession struct {
+	ws     *yaksSession
+	path   string
+	id     string
+	in     *transferWriter
+	out    *transferReader
+	mutex  sync.Mutex
+	closed bool
+}
+
+func newExecSession(ws *yaksSession, path string) (*ExecSession, error) {
+	out, err := newTransferReader(ws, path+URISeparator+"out")
+	if err != nil {
+		return nil, err
+	}
+	// the session path ends with the session id
+	id := path[strings.LastIndex(path, URISeparator)+1:]
+	return &ExecSession{ws: ws, path: path, id: id, in: newTransferWriter(ws, path+URISeparator+"in"), out: out}, nil
+}
+
+// Read reads the output of the process, it returns io.EOF when the process closes its output
+func (es *ExecSession) Read(p []byte) (int, error) {
+	return es.out.Read(p)
+}
+
+// Write writes to the standard input of the process
+func (es *ExecSession) Write(p []byte) (int, error) {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	if es.closed {
+		return 0, io.ErrClosedPipe
+	}
+	return es.in.Write(p)
+}
+
+// CloseWrite closes the standard input of the process
+func (es *ExecSession) CloseWrite() error {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	if es.closed {
+		return nil
+	}
+	es.closed = true
+	return es.in.finish(es.id, nil)
+}
+
+// Resize resizes the TTY of the process
+func (es *ExecSession) Resize(rows int, cols int) error {
+	v, err := json.Marshal(ExecTerminalSize{Rows: rows, Cols: cols})
+	if err != nil {
+		return err
+	}
+	return es.ws.Put(CreatePath([]string{es.path, "resize"}), yaks.NewStringValue(string(v)))
+}
+
+// Wait waits for the process to exit and returns its exit code
+func (es *ExecSession) Wait() (int, error) {
+	return es.WaitContext(context.Background())
+}
+
+// WaitContext waits for the process to exit and returns its exit code, or returns the error of the context
+// if it is done before
+func (es *ExecSession) WaitContext(ctx context.Context) (int, error) {
+	notify := make(chan bool, 1)
+	sid, err := es.ws.Subscribe(CreateSelector([]string{es.path, "exit"}), func(changes []yaks.Change) {
+		select {
+		case notify <- true:
+		default:
+		}
+	})
+	if err != nil {
+		return -1, err
+	}
+	defer es.ws.Unsubscribe(sid)
+
+	for {
+		kvs := es.ws.Get(CreateSelector([]string{es.path, "exit"}))
+		if len(kvs) > 0 {
+			exit := ExecExit{}
+			err := json.Unmarshal([]byte(kvs[0].Value().ToString()), &exit)
+			if err != nil {
+				return -1, &FError{"Invalid exit status", err}
+			}
+			if exit.Error != nil {
+				return exit.ExitCode, &FError{"Process failed: " + *exit.Error, nil}
+			}
+			return exit.ExitCode, nil
+		}
+		select {
+		case <-notify:
+		case <-time.After(TransferPollInterval):
+		case <-ctx.Done():
+			return -1, ctx.Err()
+		}
+	}
+}
+
+// Close terminates the process if it is still running and removes the session from YAKS
+func (es *ExecSession) Close() error {
+	es.in.stop()
+	es.CloseWrite()
+	err := es.ws.Put(CreatePath([]string{es.path, "close"}), yaks.NewStringValue(strconv.FormatInt(time.Now().Unix(), 10)))
+	es.out.Close()
+	for _, p := range []string{"resize", "close", "exit", "in/info"} {
+		es.ws.Remove(CreatePath([]string{es.path, p}))
+	}
+	return err
+}
@@ -162,16 +162,18 @@ type FDUEnergyRequirements struct {
 
 // FDUComputationalRequirements represents the FDU Computational Requirements aka Flavor
 type FDUComputationalRequirements struct {
-	Name            *string  `json:"name,omitempty"`
-	UUID            *string  `json:"uuid,omitempty"`
-	CPUArch         string   `json:"cpu_arch"`
-	CPUMinFrequency int      `json:"cpu_min_freq"`
-	CPUMinCount     int      `json:"cpu_min_count"`
-	GPUMinCount     *int     `json:"gpu_min_count,omitempty"`
-	FPGAMinCount    *int     `json:"fpga_min_count,omitempty"`
-	RAMSizeMB       float64  `json:"ram_size_mb"`
-	StorageSizeGB   float64  `json:"storage_size_gb"`
-	DutyCycle       *float64 `json:"duty_cycle,omitempty"`
+	Name                 *string  `json:"name,omitempty"`
+	UUID                 *string  `json:"uuid,omitempty"`
+	Parent               *string  `json:"parent,omitempty"`
+	CPUArch              string   `json:"cpu_arch"`
+	CPUMinFrequency      int      `json:"cpu_min_freq"`
+	CPUMinCount          int      `json:"cpu_min_count"`
+	GPUMinCount          *int     `json:"gpu_min_count,omitempty"`
+	FPGAMinCount         *int     `json:"fpga_min_count,omitempty"`
+	AcceleratorLibraries []string `json:"accelerator_libraries,omitempty"`
+	RAMSizeMB            float64  `json:"ram_size_mb"`
+	StorageSizeGB        float64  `json:"storage_size_gb"`
+	DutyCycle            *float64 `json:"duty_cycle,omitempty"`
 }
 
 // FDUConfiguration represents the FDU Configuration
@@ -244,6 +246,7 @@ type FDUStorageRecord struct {
 	Size               int     `json:"size"`
 	FileSystemProtocol *string `json:"file_system_protocol,omitempty"`
 	CPID               *string `json:"cp_id,omitempty"`
+	Path               *string `json:"path,omitempty"`
 }
 
 // FDUInterfaceRecord represent an FDU Interface Record
@@ -0,0 +1,265 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"strings"
+)
+
+// FlavorCatalog resolves the flavors of a tenant by name or UUID, expanding their inheritance
+type FlavorCatalog struct {
+	gad      *GAD
+	sysid    string
+	tenantid string
+}
+
+// NewFlavorCatalog returns the flavor catalog of the given system and tenant
+func NewFlavorCatalog(gad *GAD, sysid string, tenantid string) *FlavorCatalog {
+	return &FlavorCatalog{gad: gad, sysid: sysid, tenantid: tenantid}
+}
+
+// Get returns the flavor with the given UUID or name, with the fields inherited from its parents
+func (fc *FlavorCatalog) Get(ref string) (*FDUComputationalRequirements, error) {
+	return fc.resolve(ref, []string{})
+}
+
+// All returns all the flavors of the catalog, with the fields inherited from their parents
+func (fc *FlavorCatalog) All() ([]FDUComputationalRequirements, error) {
+	ids, err := fc.gad.GetAllFlavors(fc.sysid, fc.tenantid)
+	if err != nil {
+		return nil, err
+	}
+	res := []FDUComputationalRequirements{}
+	for _, id := range ids {
+		flv, err := fc.resolve(id, []string{})
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, *flv)
+	}
+	return res, nil
+}
+
+// ResolveFDU expands the computational requirements of the FDU when they reference a catalog flavor
+// by parent, UUID or name, the fields set in the FDU override the ones of the flavor.
+// A parent has to exist in the catalog, a UUID or a name not in the catalog is kept with the inline requirements
+func (fc *FlavorCatalog) ResolveFDU(fdu *FDU) error {
+	req := fdu.ComputationRequirements
+	var ref string
+	if req.Parent != nil && *req.Parent != "" {
+		ref = *req.Parent
+	} else {
+		for _, r := range []*string{req.UUID, req.Name} {
+			if r == nil || *r == "" {
+				continue
+			}
+			if _, _, err := fc.find(*r); err == nil {
+				ref = *r
+				break
+			}
+		}
+		if ref == "" {
+			return nil
+		}
+	}
+	flv, err := fc.Get(ref)
+	if err != nil {
+		return &FError{"Unable to resolve flavor of FDU " + fdu.ID, err}
+	}
+	req.Parent = nil
+	merged := mergeFlavor(*flv, req)
+	fdu.ComputationRequirements = merged
+	return nil
+}
+
+// resolve finds the flavor and merges it with its parents, path contains the flavors already visited
+func (fc *FlavorCatalog) resolve(ref string, path []string) (*FDUComputationalRequirements, error) {
+	id, flv, err := fc.find(ref)
+	if err != nil {
+		return nil, err
+	}
+	if contains(path, id) {
+		return nil, &FError{"Flavor inheritance cycle: " + strings.Join(append(path, id), " -> "), nil}
+	}
+	if flv.UUID == nil {
+		flv.UUID = &id
+	}
+	if flv.Parent == nil || *flv.Parent == "" {
+		return flv, nil
+	}
+	parent, err := fc.resolve(*flv.Parent, append(append([]string{}, path...), id))
+	if err != nil {
+		return nil, &FError{"Unable to resolve parent of flavor " + id, err}
+	}
+	merged := mergeFlavor(*parent, *flv)
+	merged.UUID = flv.UUID
+	merged.Name = flv.Name
+	merged.Parent = nil
+	return &merged, nil
+}
+
+// find returns the ID and the flavor with the given UUID, or with the given name
+func (fc *FlavorCatalog) find(ref string) (string, *FDUComputationalRequirements, error) {
+	flv, err := fc.gad.GetFlavor(fc.sysid, fc.tenantid, ref)
+	if err == nil {
+		return ref, flv, nil
+	}
+	ids, err := fc.gad.GetAllFlavors(fc.sysid, fc.tenantid)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, id := range ids {
+		flv, err := fc.gad.GetFlavor(fc.sysid, fc.tenantid, id)
+		if err != nil {
+			continue
+		}
+		if flv.Name != nil && *flv.Name == ref {
+			return id, flv, nil
+		}
+	}
+	return "", nil, &FError{"Flavor not found: " + ref, nil}
+}
+
+// mergeFlavor returns base with the fields set in override
+func mergeFlavor(base FDUComputationalRequirements, override FDUComputationalRequirements) FDUComputationalRequirements {
+	res := base
+	if override.Name != nil {
+		res.Name = override.Name
+	}
+	if override.UUID != nil {
+		res.UUID = override.UUID
+	}
+	if override.CPUArch != "" {
+		res.CPUArch = override.CPUArch
+	}
+	if override.CPUMinFrequency != 0 {
+		res.CPUMinFrequency = override.CPUMinFrequency
+	}
+	if override.CPUMinCount != 0 {
+		res.CPUMinCount = override.CPUMinCount
+	}
+	if override.GPUMinCount != nil {
+		res.GPUMinCount = override.GPUMinCount
+	}
+	if override.FPGAMinCount != nil {
+		res.FPGAMinCount = override.FPGAMinCount
+	}
+	if override.AcceleratorLibraries != nil {
+		res.AcceleratorLibraries = override.AcceleratorLibraries
+	}
+	if override.RAMSizeMB != 0 {
+		res.RAMSizeMB = override.RAMSizeMB
+	}
+	if override.StorageSizeGB != 0 {
+		res.StorageSizeGB = override.StorageSizeGB
+	}
+	if override.DutyCycle != nil {
+		res.DutyCycle = override.DutyCycle
+	}
+	return res
+}
+
+// NodeCanHost checks if the node satisfies the computational requirements,
+// GPUs and FPGAs are counted among the available accelerators, by type when it is known
+func NodeCanHost(node NodeInfo, flv FDUComputationalRequirements) bool {
+	cpus := 0
+	for _, cpu := range node.CPU {
+		if flv.CPUArch != "" && !strings.EqualFold(cpu.Arch, flv.CPUArch) {
+			continue
+		}
+		if cpu.Frequency < float64(flv.CPUMinFrequency) {
+			continue
+		}
+		cpus++
+	}
+	if cpus == 0 || cpus < flv.CPUMinCount {
+		return false
+	}
+	if node.RAM.Size < flv.RAMSizeMB {
+		return false
+	}
+	var disk float64
+	for _, d := range node.Disks {
+		disk += d.Dimension
+	}
+	if disk < flv.StorageSizeGB {
+		return false
+	}
+	available := map[string]int{}
+	for _, acc := range node.Accelerator {
+		if acc.Available && supportsLibraries(acc, flv.AcceleratorLibraries) {
+			available[acc.Type]++
+		}
+	}
+	gpus, fpgas := 0, 0
+	if flv.GPUMinCount != nil {
+		gpus = *flv.GPUMinCount
+	}
+	if flv.FPGAMinCount != nil {
+		fpgas = *flv.FPGAMinCount
+	}
+	// accelerators without type can be counted as GPU or FPGA
+	missing := 0
+	if available[GPU] < gpus {
+		missing += gpus - available[GPU]
+	}
+	if available[FPGA] < fpgas {
+		missing += fpgas - available[FPGA]
+	}
+	return available[""] >= missing
+}
+
+// NodeFlavors returns the catalog flavors that the node can host
+func (fc *FlavorCatalog) NodeFlavors(node NodeInfo) ([]FDUComputationalRequirements, error) {
+	all, err := fc.All()
+	if err != nil {
+		return nil, err
+	}
+	res := []FDUComputationalRequirements{}
+	for _, flv := range all {
+		if NodeCanHost(node, flv) {
+			res = append(res, flv)
+		}
+	}
+	return res, nil
+}
+
+// PublishNodeFlavors advertises the flavors that the node can host and removes the ones it can no longer host
+func (fc *FlavorCatalog) PublishNodeFlavors(node NodeInfo) error {
+	flavors, err := fc.NodeFlavors(node)
+	if err != nil {
+		return err
+	}
+	hosted := []string{}
+	for _, flv := range flavors {
+		err = fc.gad.AddNodeFlavor(fc.sysid, fc.tenantid, node.UUID, *flv.UUID, flv)
+		if err != nil {
+			return err
+		}
+		hosted = append(hosted, *flv.UUID)
+	}
+	old, err := fc.gad.GetNodeAllFlavors(fc.sysid, fc.tenantid, node.UUID)
+	if err != nil {
+		return err
+	}
+	for _, id := range old {
+		if !contains(hosted, id) {
+			err = fc.gad.RemoveNodeFlavor(fc.sysid, fc.tenantid, node.UUID, id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"sync"
+	"time"
+
+	"github.com/atolab/yaks-go"
+)
+
+const (
+	// HEALTHY is the state of a plugin that is regularly publishing its heartbeat
+	HEALTHY string = "HEALTHY"
+
+	// UNHEALTHY is the state of a plugin that missed HeartbeatUnhealthyThreshold heartbeats
+	UNHEALTHY string = "UNHEALTHY"
+
+	// DEAD is the state of a plugin that missed HeartbeatDeadThreshold heartbeats
+	DEAD string = "DEAD"
+)
+
+// DefaultHeartbeatInterval is the default interval between two heartbeats of a plugin
+const DefaultHeartbeatInterval = 5 * time.Second
+
+// HeartbeatUnhealthyThreshold is the number of missed heartbeats after which a plugin is unhealthy
+const HeartbeatUnhealthyThreshold = 2
+
+// HeartbeatDeadThreshold is the number of missed heartbeats after which a plugin is dead
+const HeartbeatDeadThreshold = 5
+
+type heartbeatPublisher struct {
+	done    chan bool
+	stopped chan bool
+}
+
+// StartHeartbeat starts publishing the plugin heartbeat every interval,
+// status and instances are called at each heartbeat to fill it, if status is nil HEALTHY is used
+func (pl *FOSPlugin) StartHeartbeat(interval time.Duration, status func() string, instances func() int) {
+	if pl.heartbeat != nil {
+		return
+	}
+	hb := &heartbeatPublisher{done: make(chan bool), stopped: make(chan bool)}
+	pl.heartbeat = hb
+	started := time.Now()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			info := PluginHeartbeat{PluginID: pl.UUID, Status: HEALTHY, Timestamp: time.Now().Unix(), Uptime: int64(time.Since(started).Seconds())}
+			if status != nil {
+				info.Status = status()
+			}
+			if instances != nil {
+				info.Instances = instances()
+			}
+			err := pl.connector.Local.Actual.AddNodePluginHeartbeat(pl.node, pl.UUID, info)
+			if err != nil {
+				pl.connector.Logger().WithField("plugin", pl.UUID).Error("Unable to publish heartbeat: " + err.Error())
+			}
+			select {
+			case <-hb.done:
+				pl.connector.Local.Actual.RemoveNodePluginHeartbeat(pl.node, pl.UUID)
+				close(hb.stopped)
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// StopHeartbeat stops publishing the plugin heartbeat and removes it from YAKS
+func (pl *FOSPlugin) StopHeartbeat() {
+	if pl.heartbeat == nil {
+		return
+	}
+	close(pl.heartbeat.done)
+	<-pl.heartbeat.stopped
+	pl.heartbeat = nil
+}
+
+type pluginLiveness struct {
+	heartbeat PluginHeartbeat
+	received  time.Time
+	state     string
+}
+
+// HeartbeatWatcher tracks the heartbeats of the plugins in a node and marks them as unhealthy or dead
+// when they miss heartbeats, the state is published as the PluginLiveness of the plugin in the local actual store,
+// the plugin record is not written by the watcher.
+// Heartbeats are timed with the clock of the watcher, the timestamps of the plugins are not compared with it
+type HeartbeatWatcher struct {
+	connector *YaksConnector
+	node      string
+	interval  time.Duration
+	listener  func(string, string)
+	mutex     sync.Mutex
+	plugins   map[string]*pluginLiveness
+	sid       *yaks.SubscriptionID
+	done      chan bool
+}
+
+// NewHeartbeatWatcher returns a watcher for the plugins of the given node, interval is the expected heartbeat interval,
+// the listener is called with the plugin UUID and the new state (HEALTHY, UNHEALTHY, DEAD) at each state change
+func NewHeartbeatWatcher(connector *YaksConnector, nodeid string, interval time.Duration, listener func(string, string)) (*HeartbeatWatcher, error) {
+	hw := &HeartbeatWatcher{connector: connector, node: nodeid, interval: interval, listener: listener, plugins: map[string]*pluginLiveness{}, done: make(chan bool)}
+
+	sid, err := connector.Local.Actual.ObserveNodePluginsHeartbeats(nodeid, hw.update)
+	if err != nil {
+		return nil, err
+	}
+	hw.sid = sid
+
+	hbs, err := connector.Local.Actual.GetAllNodePluginsHeartbeats(nodeid)
+	if err != nil {
+		hw.Close()
+		return nil, err
+	}
+	hw.mutex.Lock()
+	known := []string{}
+	for _, hb := range hbs {
+		if _, found := hw.plugins[hb.PluginID]; !found {
+			hw.plugins[hb.PluginID] = &pluginLiveness{heartbeat: hb, received: time.Now(), state: HEALTHY}
+			known = append(known, hb.PluginID)
+		}
+	}
+	hw.mutex.Unlock()
+	for _, pid := range known {
+		hw.publish(pid, HEALTHY)
+	}
+
+	go hw.run()
+	return hw, nil
+}
+
+// Close stops the watcher
+func (hw *HeartbeatWatcher) Close() error {
+	select {
+	case <-hw.done:
+		return nil
+	default:
+		close(hw.done)
+	}
+	return hw.connector.Local.Actual.Unsubscribe(hw.sid)
+}
+
+// State returns the liveness state of the given plugin and its last heartbeat
+func (hw *HeartbeatWatcher) State(pluginid string) (string, *PluginHeartbeat, error) {
+	hw.mutex.Lock()
+	defer hw.mutex.Unlock()
+	pl, found := hw.plugins[pluginid]
+	if !found {
+		return "", nil, &FError{"No heartbeat received from plugin " + pluginid, nil}
+	}
+	hb := pl.heartbeat
+	return pl.state, &hb, nil
+}
+
+// States returns the liveness state of all the plugins known by the watcher
+func (hw *HeartbeatWatcher) States() map[string]string {
+	hw.mutex.Lock()
+	defer hw.mutex.Unlock()
+	res := map[string]string{}
+	for pid, pl := range hw.plugins {
+		res[pid] = pl.state
+	}
+	return res
+}
+
+func (hw *HeartbeatWatcher) update(pluginid string, hb *PluginHeartbeat, removed bool) {
+	hw.mutex.Lock()
+	if removed {
+		_, found := hw.plugins[pluginid]
+		delete(hw.plugins, pluginid)
+		hw.mutex.Unlock()
+		if found {
+			hw.connector.Local.Actual.RemoveNodePluginLiveness(hw.node, pluginid)
+		}
+		return
+	}
+	pl, found := hw.plugins[pluginid]
+	if !found {
+		pl = &pluginLiveness{}
+		hw.plugins[pluginid] = pl
+	}
+	old := pl.state
+	pl.heartbeat = *hb
+	pl.received = time.Now()
+	pl.state = HEALTHY
+	hw.mutex.Unlock()
+
+	if old != HEALTHY {
+		hw.changed(pluginid, HEALTHY)
+	}
+}
+
+// changed publishes the new liveness state of the plugin and notifies the listener
+func (hw *HeartbeatWatcher) changed(pluginid string, state string) {
+	hw.publish(pluginid, state)
+	if hw.listener != nil {
+		hw.listener(pluginid, state)
+	}
+}
+
+// publish writes the liveness state of the plugin, unless its heartbeat has been removed meanwhile
+func (hw *HeartbeatWatcher) publish(pluginid string, state string) {
+	hw.mutex.Lock()
+	_, found := hw.plugins[pluginid]
+	hw.mutex.Unlock()
+	if !found {
+		return
+	}
+	info := PluginLiveness{PluginID: pluginid, State: state, Timestamp: time.Now().Unix()}
+	err := hw.connector.Local.Actual.AddNodePluginLiveness(hw.node, pluginid, info)
+	if err != nil {
+		hw.connector.Logger().WithField("plugin", pluginid).Warn("Unable to publish plugin state " + state + ": " + err.Error())
+	}
+}
+
+func (hw *HeartbeatWatcher) run() {
+	ticker := time.NewTicker(hw.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-hw.done:
+			return
+		case <-ticker.C:
+		}
+		hw.check(time.Now())
+	}
+}
+
+// check updates the state of all the plugins given the current time
+func (hw *HeartbeatWatcher) check(now time.Time) {
+	changes := map[string]string{}
+
+	hw.mutex.Lock()
+	for pid, pl := range hw.plugins {
+		missed := int(now.Sub(pl.received) / hw.interval)
+		state := HEALTHY
+		if missed >= HeartbeatDeadThreshold {
+			state = DEAD
+		} else if missed >= HeartbeatUnhealthyThreshold {
+			state = UNHEALTHY
+		}
+		if state != pl.state {
+			pl.state = state
+			changes[pid] = state
+		}
+	}
+	hw.mutex.Unlock()
+
+	for pid, state := range changes {
+		hw.changed(pid, state)
+	}
+}
@@ -0,0 +1,463 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultImageDownloadTimeout is the default timeout of an image download
+const DefaultImageDownloadTimeout = 30 * time.Minute
+
+// ImageDownloadRetries is the number of times an interrupted HTTP download is resumed
+const ImageDownloadRetries = 3
+
+type cachedImage struct {
+	digest   string
+	path     string
+	size     int64
+	refs     int
+	lastUsed time.Time
+	images   map[string]FDUImage
+}
+
+// ImageManager downloads, verifies and caches the images used by a runtime plugin.
+// Images are stored in a content-addressed cache, indexed by their SHA256, with reference counting,
+// unreferenced images are evicted in least recently used order when the cache exceeds its size
+type ImageManager struct {
+	connector *YaksConnector
+	agent     *Agent
+	node      string
+	plugin    string
+	dir       string
+	maxSize   int64
+	client    *http.Client
+	mutex     sync.Mutex
+	blobs     map[string]*cachedImage
+	byImage   map[string]string
+	pending   map[string]chan bool
+}
+
+// NewImageManager returns an image manager caching the images in dir, maxSize is the maximum size
+// in bytes of the cache, 0 means unlimited. Images already in dir are added to the cache as unreferenced
+func NewImageManager(connector *YaksConnector, agent *Agent, nodeid string, pluginid string, dir string, maxSize int64) (*ImageManager, error) {
+	im := &ImageManager{connector: connector, agent: agent, node: nodeid, plugin: pluginid, dir: dir, maxSize: maxSize,
+		client: &http.Client{Timeout: DefaultImageDownloadTimeout}, blobs: map[string]*cachedImage{}, byImage: map[string]string{}, pending: map[string]chan bool{}}
+
+	err := os.MkdirAll(im.blobsDir(), 0755)
+	if err != nil {
+		return nil, &FError{"Unable to create image cache " + dir, err}
+	}
+	files, err := ioutil.ReadDir(im.blobsDir())
+	if err != nil {
+		return nil, &FError{"Unable to read image cache " + dir, err}
+	}
+	for _, f := range files {
+		if f.IsDir() || strings.HasSuffix(f.Name(), ".tmp") || strings.HasSuffix(f.Name(), ".part") {
+			continue
+		}
+		im.blobs[f.Name()] = &cachedImage{digest: f.Name(), path: filepath.Join(im.blobsDir(), f.Name()), size: f.Size(), lastUsed: f.ModTime(), images: map[string]FDUImage{}}
+	}
+	return im, nil
+}
+
+// Acquire resolves the image by UUID through the agent, downloads it if it is not cached
+// and returns the path of the image, each Acquire has to be followed by a Release
+func (im *ImageManager) Acquire(imageid string) (string, error) {
+	img, err := im.agent.GetImageInfo(imageid)
+	if err != nil {
+		return "", err
+	}
+	if img.UUID == nil {
+		img.UUID = &imageid
+	}
+	return im.AcquireImage(*img)
+}
+
+// AcquireImage downloads the given image if it is not cached and returns its path, the image must have
+// a checksum, each AcquireImage has to be followed by a Release
+func (im *ImageManager) AcquireImage(img FDUImage) (string, error) {
+	if img.UUID == nil {
+		return "", &FError{"Image without UUID", nil}
+	}
+	id := *img.UUID
+	if strings.TrimSpace(img.Checksum) == "" {
+		return "", &FError{"Image without checksum: " + id, nil}
+	}
+
+	for {
+		im.mutex.Lock()
+		if digest, found := im.byImage[id]; found {
+			blob := im.blobs[digest]
+			blob.refs++
+			blob.lastUsed = time.Now()
+			im.mutex.Unlock()
+			return blob.path, nil
+		}
+		wait, found := im.pending[id]
+		if !found {
+			im.pending[id] = make(chan bool)
+			im.mutex.Unlock()
+			break
+		}
+		im.mutex.Unlock()
+		<-wait
+	}
+
+	path, err := im.fetch(img)
+
+	im.mutex.Lock()
+	close(im.pending[id])
+	delete(im.pending, id)
+	im.mutex.Unlock()
+	return path, err
+}
+
+// Release releases an image acquired by Acquire or AcquireImage, unreferenced images remain cached
+// until they are evicted
+func (im *ImageManager) Release(imageid string) error {
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+	digest, found := im.byImage[imageid]
+	if !found {
+		return &FError{"Image not in cache: " + imageid, nil}
+	}
+	blob := im.blobs[digest]
+	if blob.refs > 0 {
+		blob.refs--
+	}
+	blob.lastUsed = time.Now()
+	return nil
+}
+
+// Prune removes all the unreferenced images from the cache
+func (im *ImageManager) Prune() error {
+	im.mutex.Lock()
+	evicted := []string{}
+	var err error
+	for _, blob := range im.lru() {
+		var ids []string
+		ids, err = im.evict(blob)
+		if err != nil {
+			break
+		}
+		evicted = append(evicted, ids...)
+	}
+	im.mutex.Unlock()
+	im.unpublish(evicted)
+	return err
+}
+
+// Size returns the size in bytes of the cached images
+func (im *ImageManager) Size() int64 {
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+	return im.size()
+}
+
+// fetch downloads the image, verifies its checksum, adds it to the cache and records it in the node
+func (im *ImageManager) fetch(img FDUImage) (string, error) {
+	id := *img.UUID
+	digest, size, err := im.retrieve(img)
+	if err != nil {
+		return "", err
+	}
+	part := im.partialPath(id)
+
+	im.mutex.Lock()
+	blob, found := im.blobs[digest]
+	if !found {
+		blob = &cachedImage{digest: digest, path: filepath.Join(im.blobsDir(), digest), size: size, images: map[string]FDUImage{}}
+		err = os.Rename(part, blob.path)
+		if err != nil {
+			im.mutex.Unlock()
+			os.Remove(part)
+			return "", &FError{"Unable to store image " + id, err}
+		}
+		im.blobs[digest] = blob
+	} else {
+		os.Remove(part)
+	}
+	blob.refs++
+	blob.lastUsed = time.Now()
+	blob.images[id] = img
+	im.byImage[id] = digest
+	path := blob.path
+	evicted := im.shrink()
+	im.mutex.Unlock()
+
+	local := img
+	local.URI = "file://" + path
+	err = im.connector.Local.Actual.AddNodeImage(im.node, im.plugin, id, local)
+	if err != nil {
+		im.log().WithField("image", id).Error("Unable to record node image: " + err.Error())
+	}
+	im.unpublish(evicted)
+	return path, nil
+}
+
+// retrieve downloads the image in its partial file, resuming a previous interrupted download,
+// and verifies its checksum, it returns the SHA256 and the size of the image
+func (im *ImageManager) retrieve(img FDUImage) (string, int64, error) {
+	part := im.partialPath(*img.UUID)
+	size, err := im.download(img.URI, part)
+	if err != nil {
+		return "", 0, &FError{"Unable to download image " + img.URI, err}
+	}
+	s1, s256, err := fileDigests(part)
+	if err != nil {
+		return "", 0, &FError{"Unable to read image " + *img.UUID, err}
+	}
+	err = verifyChecksum(img.Checksum, s1, s256)
+	if err != nil {
+		// the partial file is not a prefix of the image, the next download starts from the beginning
+		os.Remove(part)
+		return "", 0, err
+	}
+	return s256, size, nil
+}
+
+// download copies the content of the URI in the file at path and returns its size,
+// an HTTP download continues from the content already in the file
+func (im *ImageManager) download(uri string, path string) (int64, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return 0, err
+	}
+	switch u.Scheme {
+	case "file":
+		src, err := os.Open(u.Path)
+		if err != nil {
+			return 0, err
+		}
+		defer src.Close()
+		dst, err := os.Create(path)
+		if err != nil {
+			return 0, err
+		}
+		n, err := io.Copy(dst, src)
+		cerr := dst.Close()
+		if err == nil {
+			err = cerr
+		}
+		return n, err
+	case "http", "https":
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		for attempt := 0; ; attempt++ {
+			retry, err := im.resume(uri, f)
+			if err == nil {
+				return f.Seek(0, io.SeekCurrent)
+			}
+			if !retry || attempt >= ImageDownloadRetries {
+				return 0, err
+			}
+			im.log().WithFields(log.Fields{"uri": uri, "error": err}).Warn("Image download interrupted, resuming")
+		}
+	default:
+		return 0, &FError{"Unsupported URI scheme: " + u.Scheme, nil}
+	}
+}
+
+// log returns the logger of the connector, the SDK logger if the manager has no connector
+func (im *ImageManager) log() log.FieldLogger {
+	if im.connector == nil {
+		return logger
+	}
+	return im.connector.Logger()
+}
+
+// resume requests the content of the URI following what is already in f and appends it to f,
+// it returns true if the download failed and can be resumed
+func (im *ImageManager) resume(uri string, f *os.File) (bool, error) {
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return false, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := im.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		// the server sends the whole image
+		err = restart(f)
+		if err != nil {
+			return false, err
+		}
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			return false, &FError{"Unexpected content range " + resp.Header.Get("Content-Range"), nil}
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// the partial file is longer than the image, it is downloaded again
+		err = restart(f)
+		if err != nil {
+			return false, err
+		}
+		return true, &FError{"Partial image longer than the image", nil}
+	default:
+		return false, &FError{fmt.Sprintf("Unexpected HTTP status %s", resp.Status), nil}
+	}
+	_, err = io.Copy(f, resp.Body)
+	if err != nil {
+		return true, err
+	}
+	return false, nil
+}
+
+// restart empties the file to download it again from the beginning
+func restart(f *os.File) error {
+	err := f.Truncate(0)
+	if err != nil {
+		return err
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	return err
+}
+
+// fileDigests returns the SHA1 and the SHA256 of the file
+func fileDigests(path string) (string, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+	s1 := sha1.New()
+	s256 := sha256.New()
+	_, err = io.Copy(io.MultiWriter(s1, s256), f)
+	if err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(s1.Sum(nil)), hex.EncodeToString(s256.Sum(nil)), nil
+}
+
+// verifyChecksum checks the expected checksum, a SHA1 or a SHA256 optionally prefixed by the algorithm
+func verifyChecksum(expected string, s1 string, s256 string) error {
+	expected = strings.ToLower(strings.TrimSpace(expected))
+	if expected == "" {
+		return &FError{"Image without checksum", nil}
+	}
+	expected = strings.TrimPrefix(strings.TrimPrefix(expected, "sha256:"), "sha1:")
+	var actual string
+	switch len(expected) {
+	case sha1.Size * 2:
+		actual = s1
+	case sha256.Size * 2:
+		actual = s256
+	default:
+		return &FError{"Unsupported checksum: " + expected, nil}
+	}
+	if actual != expected {
+		return &FError{fmt.Sprintf("Checksum mismatch, expected %s got %s", expected, actual), nil}
+	}
+	return nil
+}
+
+// shrink evicts unreferenced images until the cache fits in its maximum size,
+// it returns the evicted images
+func (im *ImageManager) shrink() []string {
+	evicted := []string{}
+	if im.maxSize <= 0 {
+		return evicted
+	}
+	for _, blob := range im.lru() {
+		if im.size() <= im.maxSize {
+			break
+		}
+		ids, err := im.evict(blob)
+		if err != nil {
+			im.log().WithField("image", blob.digest).Error("Unable to evict image: " + err.Error())
+		}
+		evicted = append(evicted, ids...)
+	}
+	return evicted
+}
+
+// lru returns the unreferenced images, least recently used first
+func (im *ImageManager) lru() []*cachedImage {
+	res := []*cachedImage{}
+	for _, blob := range im.blobs {
+		if blob.refs == 0 {
+			res = append(res, blob)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].lastUsed.Before(res[j].lastUsed) })
+	return res
+}
+
+// evict removes the image from the cache and returns the images it was stored for
+func (im *ImageManager) evict(blob *cachedImage) ([]string, error) {
+	err := os.Remove(blob.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	ids := []string{}
+	for id := range blob.images {
+		delete(im.byImage, id)
+		ids = append(ids, id)
+	}
+	delete(im.blobs, blob.digest)
+	return ids, nil
+}
+
+// unpublish removes the evicted images from the node, it is called without holding the mutex
+func (im *ImageManager) unpublish(ids []string) {
+	for _, id := range ids {
+		im.connector.Local.Actual.RemoveNodeImage(im.node, im.plugin, id)
+	}
+}
+
+func (im *ImageManager) size() int64 {
+	var total int64
+	for _, blob := range im.blobs {
+		total += blob.size
+	}
+	return total
+}
+
+func (im *ImageManager) blobsDir() string {
+	return filepath.Join(im.dir, "blobs")
+}
+
+// partialPath is the path of the partial download of the given image, kept to resume the download
+func (im *ImageManager) partialPath(imageid string) string {
+	return filepath.Join(im.blobsDir(), url.PathEscape(imageid)+".part")
+}
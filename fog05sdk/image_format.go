@@ -0,0 +1,382 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// QCOW2 is the QEMU copy on write image format
+	QCOW2 string = "qcow2"
+
+	// RAW is the raw disk image format
+	RAW string = "raw"
+
+	// ISO is the ISO9660 image format
+	ISO string = "iso"
+
+	// TAR is the tarball image format, eg. a container rootfs
+	TAR string = "tar"
+
+	// TARGZ is the gzip compressed tarball image format, eg. a container rootfs
+	TARGZ string = "tar.gz"
+
+	// OCI is the OCI image layout format
+	OCI string = "oci"
+
+	// ELF is the ELF executable format
+	ELF string = "elf"
+
+	// WASM is the WebAssembly binary format
+	WASM string = "wasm"
+)
+
+// sparseBlockSize is the size of the blocks checked for zeroes when copying a raw image
+const sparseBlockSize = 64 * 1024
+
+// imageFormatAliases maps the common names of the formats to the format constants
+var imageFormatAliases = map[string]string{
+	"qcow2":  QCOW2,
+	"raw":    RAW,
+	"img":    RAW,
+	"iso":    ISO,
+	"tar":    TAR,
+	"tar.gz": TARGZ,
+	"tgz":    TARGZ,
+	"oci":    OCI,
+	"elf":    ELF,
+	"bin":    ELF,
+	"wasm":   WASM,
+}
+
+// NormalizeImageFormat returns the format constant of the given format name
+func NormalizeImageFormat(format string) (string, error) {
+	f, found := imageFormatAliases[strings.ToLower(strings.TrimSpace(format))]
+	if !found {
+		return "", &FError{"Unknown image format: " + format, nil}
+	}
+	return f, nil
+}
+
+// DetectImageFormat detects the format of the image in path from its header,
+// a directory is detected as OCI if it contains an OCI layout
+func DetectImageFormat(path string) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if fi.IsDir() {
+		_, err := os.Stat(filepath.Join(path, "oci-layout"))
+		if err != nil {
+			return "", &FError{"Directory is not an OCI layout: " + path, nil}
+		}
+		return OCI, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	header := make([]byte, 1024)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, []byte("QFI\xfb")):
+		return QCOW2, nil
+	case bytes.HasPrefix(header, []byte("\x7fELF")):
+		return ELF, nil
+	case bytes.HasPrefix(header, []byte("\x00asm")):
+		return WASM, nil
+	case bytes.HasPrefix(header, []byte("\x1f\x8b")):
+		return detectCompressedTar(path)
+	case isTarHeader(header):
+		return TAR, nil
+	}
+
+	iso := make([]byte, 5)
+	_, err = f.ReadAt(iso, 0x8001)
+	if err == nil && string(iso) == "CD001" {
+		return ISO, nil
+	}
+	// MBR boot signature or GPT header
+	if (len(header) >= 512 && header[510] == 0x55 && header[511] == 0xaa) || (len(header) >= 520 && string(header[512:520]) == "EFI PART") {
+		return RAW, nil
+	}
+	return "", &FError{"Unknown image format: " + path, nil}
+}
+
+// ValidateImageFormat checks that the image in path matches the declared format,
+// a raw image is accepted also when it has no partition table since raw has no header
+func ValidateImageFormat(path string, declared string) (string, error) {
+	format, err := NormalizeImageFormat(declared)
+	if err != nil {
+		return "", err
+	}
+	detected, err := DetectImageFormat(path)
+	if err != nil {
+		if format == RAW {
+			return RAW, nil
+		}
+		return "", err
+	}
+	if detected != format {
+		return "", &FError{"Image format mismatch, declared " + declared + " detected " + detected, nil}
+	}
+	return format, nil
+}
+
+func isTarHeader(header []byte) bool {
+	return len(header) >= 262 && string(header[257:262]) == "ustar"
+}
+
+func detectCompressedTar(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return "", &FError{"Invalid gzip image", err}
+	}
+	defer gz.Close()
+	header := make([]byte, 512)
+	n, err := io.ReadFull(gz, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", &FError{"Invalid gzip image", err}
+	}
+	if !isTarHeader(header[:n]) {
+		return "", &FError{"Compressed image is not a tarball: " + path, nil}
+	}
+	return TARGZ, nil
+}
+
+// ExtractRootfs extracts a tarball, compressed or not, in the dest directory,
+// entries escaping dest are rejected and device nodes are skipped
+func ExtractRootfs(tarball string, dest string) error {
+	format, err := DetectImageFormat(tarball)
+	if err != nil {
+		return err
+	}
+	if format != TAR && format != TARGZ {
+		return &FError{"Image is not a tarball: " + tarball, nil}
+	}
+	f, err := os.Open(tarball)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = bufio.NewReader(f)
+	if format == TARGZ {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return &FError{"Invalid gzip image", err}
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	err = os.MkdirAll(dest, 0755)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return &FError{"Invalid tarball", err}
+		}
+		target, err := securePath(dest, hdr.Name)
+		if err != nil {
+			return err
+		}
+		mode := os.FileMode(hdr.Mode).Perm()
+		// every entry is checked, a symlink extracted before must not redirect
+		// a directory, a link or a file outside dest
+		err = checkParent(dest, target)
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if fi, lerr := os.Lstat(target); lerr == nil && fi.Mode()&os.ModeSymlink != 0 {
+				os.Remove(target)
+			}
+			err = os.MkdirAll(target, mode|0700)
+		case tar.TypeReg, tar.TypeRegA:
+			err = extractFile(tr, target, mode)
+		case tar.TypeSymlink:
+			err = os.MkdirAll(filepath.Dir(target), 0755)
+			if err == nil {
+				os.Remove(target)
+				err = os.Symlink(hdr.Linkname, target)
+			}
+		case tar.TypeLink:
+			var source string
+			source, err = securePath(dest, hdr.Linkname)
+			if err == nil {
+				err = checkParent(dest, source)
+			}
+			if err == nil {
+				err = os.MkdirAll(filepath.Dir(target), 0755)
+			}
+			if err == nil {
+				os.Remove(target)
+				err = os.Link(source, target)
+			}
+		default:
+			logger.WithField("entry", hdr.Name).Warn("Skipping unsupported tar entry")
+			continue
+		}
+		if err != nil {
+			return &FError{"Unable to extract " + hdr.Name, err}
+		}
+		if hdr.Typeflag != tar.TypeSymlink {
+			os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+		}
+	}
+}
+
+// securePath joins name to dest rejecting names that escape dest
+func securePath(dest string, name string) (string, error) {
+	target := filepath.Join(dest, name)
+	if !within(dest, target) {
+		return "", &FError{"Tar entry escapes destination: " + name, nil}
+	}
+	return target, nil
+}
+
+func within(root string, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
+}
+
+// checkParent rejects targets whose parent directory resolves outside dest through a symlink
+// extracted before, the deepest existing ancestor is checked since the others are created by the extraction
+func checkParent(dest string, target string) error {
+	root, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(target)
+	for within(dest, dir) {
+		_, err := os.Lstat(dir)
+		if err == nil {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	parent, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if !within(root, parent) {
+		return &FError{"Tar entry escapes destination through a symlink: " + target, nil}
+	}
+	return nil
+}
+
+func extractFile(r io.Reader, target string, mode os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+	os.Remove(target)
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	cerr := f.Close()
+	if err != nil {
+		return err
+	}
+	return cerr
+}
+
+// CopySparse copies a raw image skipping the blocks of zeroes, so that the copy is a sparse file,
+// and returns the number of bytes actually written
+func CopySparse(src string, dst string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, err
+	}
+
+	var written, offset int64
+	buf := make([]byte, sparseBlockSize)
+	zero := make([]byte, sparseBlockSize)
+	for {
+		n, rerr := io.ReadFull(in, buf)
+		if n > 0 {
+			if !bytes.Equal(buf[:n], zero[:n]) {
+				_, err = out.WriteAt(buf[:n], offset)
+				if err != nil {
+					out.Close()
+					return written, err
+				}
+				written += int64(n)
+			}
+			offset += int64(n)
+		}
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			break
+		}
+		if rerr != nil {
+			out.Close()
+			return written, rerr
+		}
+	}
+	// the trailing holes are not written, truncate sets the right size
+	err = out.Truncate(offset)
+	cerr := out.Close()
+	if err != nil {
+		return written, err
+	}
+	return written, cerr
+}
+
+// ResizeRaw grows a raw image to size bytes, the new space is a hole, raw images cannot be shrunk
+func ResizeRaw(path string, size int64) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if size < fi.Size() {
+		return &FError{"Raw images cannot be shrunk", nil}
+	}
+	return os.Truncate(path, size)
+}
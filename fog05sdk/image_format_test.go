@@ -0,0 +1,95 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTar(t *testing.T, path string, headers []*tar.Header) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	for _, h := range headers {
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractRootfsSymlinkEscape(t *testing.T) {
+	cases := map[string]*tar.Header{
+		"dir":     {Name: "a/x", Typeflag: tar.TypeDir, Mode: 0755},
+		"symlink": {Name: "a/y", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd", Mode: 0777},
+	}
+	for name, entry := range cases {
+		t.Run(name, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "fos-rootfs")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+			outside := filepath.Join(tmp, "outside")
+			if err := os.Mkdir(outside, 0755); err != nil {
+				t.Fatal(err)
+			}
+			tarball := filepath.Join(tmp, "rootfs.tar")
+			writeTar(t, tarball, []*tar.Header{
+				{Name: "a", Typeflag: tar.TypeSymlink, Linkname: outside, Mode: 0777},
+				entry,
+			})
+			err = ExtractRootfs(tarball, filepath.Join(tmp, "dest"))
+			if err == nil {
+				t.Fatal("extraction through a symlink escaping dest succeeded")
+			}
+			files, _ := ioutil.ReadDir(outside)
+			if len(files) != 0 {
+				t.Fatalf("entry %s written outside dest", files[0].Name())
+			}
+		})
+	}
+}
+
+func TestExtractRootfs(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "fos-rootfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	tarball := filepath.Join(tmp, "rootfs.tar")
+	writeTar(t, tarball, []*tar.Header{
+		{Name: "bin", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "usr/bin", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "sbin", Typeflag: tar.TypeSymlink, Linkname: "usr/bin", Mode: 0777},
+		{Name: "sbin/init", Typeflag: tar.TypeSymlink, Linkname: "/bin/sh", Mode: 0777},
+	})
+	dest := filepath.Join(tmp, "dest")
+	if err := ExtractRootfs(tarball, dest); err != nil {
+		t.Fatal(err)
+	}
+	link, err := os.Readlink(filepath.Join(dest, "usr", "bin", "init"))
+	if err != nil || link != "/bin/sh" {
+		t.Fatalf("unexpected link %q: %v", link, err)
+	}
+}
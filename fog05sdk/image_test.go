@@ -0,0 +1,167 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestImageManager returns an image manager caching in a temporary directory, it has no connector
+// so only the download and the verification of the images can be tested
+func newTestImageManager(t *testing.T) (*ImageManager, string) {
+	dir, err := ioutil.TempDir("", "fos-images")
+	if err != nil {
+		t.Fatal(err)
+	}
+	im, err := NewImageManager(nil, nil, "node", "plugin", dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return im, dir
+}
+
+func testImage(uri string, checksum string) FDUImage {
+	id := "image-0"
+	return FDUImage{UUID: &id, URI: uri, Checksum: checksum}
+}
+
+func TestImageDownload(t *testing.T) {
+	data := bytes.Repeat([]byte("fog05"), 4096)
+	s1 := sha1.Sum(data)
+	s256 := sha256.Sum256(data)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer server.Close()
+	im, dir := newTestImageManager(t)
+	defer os.RemoveAll(dir)
+
+	for _, checksum := range []string{hex.EncodeToString(s1[:]), "sha256:" + strings.ToUpper(hex.EncodeToString(s256[:]))} {
+		digest, size, err := im.retrieve(testImage(server.URL+"/image.qcow2", checksum))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if digest != hex.EncodeToString(s256[:]) || size != int64(len(data)) {
+			t.Fatalf("unexpected digest %s and size %d", digest, size)
+		}
+		content, err := ioutil.ReadFile(im.partialPath("image-0"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(content, data) {
+			t.Fatal("downloaded image differs")
+		}
+		os.Remove(im.partialPath("image-0"))
+	}
+}
+
+func TestImageChecksumMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("corrupted image"))
+	}))
+	defer server.Close()
+	im, dir := newTestImageManager(t)
+	defer os.RemoveAll(dir)
+
+	_, _, err := im.retrieve(testImage(server.URL, strings.Repeat("0", 64)))
+	if err == nil || !strings.Contains(err.Error(), "Checksum mismatch") {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+	if _, err := os.Stat(im.partialPath("image-0")); !os.IsNotExist(err) {
+		t.Fatal("corrupted image not removed")
+	}
+}
+
+func TestImageWithoutChecksum(t *testing.T) {
+	im, dir := newTestImageManager(t)
+	defer os.RemoveAll(dir)
+
+	_, err := im.AcquireImage(testImage("http://127.0.0.1:1/image", " "))
+	if err == nil || !strings.Contains(err.Error(), "without checksum") {
+		t.Fatalf("expected an error for the missing checksum, got %v", err)
+	}
+}
+
+func TestImageDownloadResume(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	s256 := sha256.Sum256(data)
+	var mutex sync.Mutex
+	ranges := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		first := len(ranges) == 1
+		mutex.Unlock()
+		if first {
+			// the connection is dropped in the middle of the image
+			w.Header().Set("Content-Length", "100000")
+			w.Write(data[:40000])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "image", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+	im, dir := newTestImageManager(t)
+	defer os.RemoveAll(dir)
+
+	digest, size, err := im.retrieve(testImage(server.URL, hex.EncodeToString(s256[:])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest != hex.EncodeToString(s256[:]) || size != int64(len(data)) {
+		t.Fatalf("unexpected digest %s and size %d", digest, size)
+	}
+	if len(ranges) != 2 || ranges[0] != "" || ranges[1] != "bytes=40000-" {
+		t.Fatalf("unexpected requests %v", ranges)
+	}
+}
+
+func TestImageDownloadResumePartial(t *testing.T) {
+	data := bytes.Repeat([]byte("fog05"), 1000)
+	s256 := sha256.Sum256(data)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "bytes=2000-" {
+			t.Errorf("unexpected range %q", r.Header.Get("Range"))
+		}
+		http.ServeContent(w, r, "image", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+	im, dir := newTestImageManager(t)
+	defer os.RemoveAll(dir)
+
+	// a previous download stopped after 2000 bytes
+	err := ioutil.WriteFile(im.partialPath("image-0"), data[:2000], 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, size, err := im.retrieve(testImage(server.URL, "sha256:"+hex.EncodeToString(s256[:])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(data)) {
+		t.Fatalf("unexpected size %d", size)
+	}
+}
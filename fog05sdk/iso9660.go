@@ -0,0 +1,227 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// isoSectorSize is the logical block size of the ISO9660 images
+const isoSectorSize = 2048
+
+// Layout of the images written by writeISO9660, all the files are in the root directory
+const (
+	isoPVDSector         = 16
+	isoSVDSector         = 17
+	isoTerminatorSector  = 18
+	isoPathTablesSector  = 19 // L and M path tables of the primary and of the Joliet descriptors
+	isoRootSector        = 23
+	isoJolietRootSector  = 24
+	isoFirstDataSector   = 25
+	isoPathTableSize     = 10
+	isoDirRecordBaseSize = 33
+)
+
+type isoFile struct {
+	name   string
+	data   []byte
+	sector uint32
+}
+
+// writeISO9660 writes an ISO9660 image with Joliet extensions containing the given files in its root directory,
+// Joliet keeps the original file names, the primary descriptor has level 1 names
+func writeISO9660(path string, label string, files map[string][]byte) error {
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entries := []isoFile{}
+	sector := uint32(isoFirstDataSector)
+	for _, name := range names {
+		data := files[name]
+		entries = append(entries, isoFile{name: name, data: data, sector: sector})
+		sector += uint32((len(data) + isoSectorSize - 1) / isoSectorSize)
+	}
+	total := sector
+
+	primary := isoDirectory(entries, isoRootSector, isoLevel1Name)
+	joliet := isoDirectory(entries, isoJolietRootSector, isoJolietName)
+	if len(primary) > isoSectorSize || len(joliet) > isoSectorSize {
+		return &FError{"Too many files for the ISO image", nil}
+	}
+
+	img := make([]byte, int(total)*isoSectorSize)
+	now := time.Now().UTC()
+	copy(img[isoPVDSector*isoSectorSize:], isoVolumeDescriptor(1, label, total, isoRootSector, isoPathTablesSector, now))
+	copy(img[isoSVDSector*isoSectorSize:], isoVolumeDescriptor(2, label, total, isoJolietRootSector, isoPathTablesSector+2, now))
+	term := img[isoTerminatorSector*isoSectorSize:]
+	term[0] = 255
+	copy(term[1:6], "CD001")
+	term[6] = 1
+
+	for i, root := range []uint32{isoRootSector, isoJolietRootSector} {
+		l := img[(isoPathTablesSector+2*i)*isoSectorSize:]
+		m := img[(isoPathTablesSector+2*i+1)*isoSectorSize:]
+		for _, t := range [][]byte{l, m} {
+			t[0] = 1
+			t[6] = 1
+		}
+		binary.LittleEndian.PutUint32(l[2:6], root)
+		binary.LittleEndian.PutUint16(l[6:8], 1)
+		binary.BigEndian.PutUint32(m[2:6], root)
+		binary.BigEndian.PutUint16(m[6:8], 1)
+	}
+
+	copy(img[isoRootSector*isoSectorSize:], primary)
+	copy(img[isoJolietRootSector*isoSectorSize:], joliet)
+	for _, e := range entries {
+		copy(img[int(e.sector)*isoSectorSize:], e.data)
+	}
+	return ioutil.WriteFile(path, img, 0644)
+}
+
+// isoVolumeDescriptor returns a primary (kind 1) or a Joliet supplementary (kind 2) volume descriptor
+func isoVolumeDescriptor(kind byte, label string, total uint32, root uint32, pathTables uint32, now time.Time) []byte {
+	vd := make([]byte, isoSectorSize)
+	vd[0] = kind
+	copy(vd[1:6], "CD001")
+	vd[6] = 1
+
+	text := func(field []byte, s string) {
+		if kind == 1 {
+			padded := s + strings.Repeat(" ", len(field))
+			copy(field, strings.ToUpper(padded[:len(field)]))
+			return
+		}
+		for i := 0; i+1 < len(field); i += 2 {
+			field[i], field[i+1] = 0, ' '
+		}
+		copy(field, ucs2(s))
+	}
+	text(vd[8:40], "")
+	text(vd[40:72], label)
+	putBothEndian32(vd[80:88], total)
+	if kind == 2 {
+		copy(vd[88:91], "%/E") // UCS-2 level 3
+	}
+	putBothEndian16(vd[120:124], 1)
+	putBothEndian16(vd[124:128], 1)
+	putBothEndian16(vd[128:132], isoSectorSize)
+	putBothEndian32(vd[132:140], isoPathTableSize)
+	binary.LittleEndian.PutUint32(vd[140:144], pathTables)
+	binary.BigEndian.PutUint32(vd[148:152], pathTables+1)
+	copy(vd[156:190], isoDirRecord([]byte{0}, root, isoSectorSize, true, now))
+	for _, f := range [][]byte{vd[190:318], vd[318:446], vd[446:574], vd[574:702], vd[702:739], vd[739:776], vd[776:813]} {
+		text(f, "")
+	}
+	date := []byte(now.Format("20060102150405") + "00")
+	copy(vd[813:829], date)
+	copy(vd[830:846], date)
+	copy(vd[847:863], "0000000000000000")
+	copy(vd[864:880], "0000000000000000")
+	vd[881] = 1
+	return vd
+}
+
+// isoDirectory returns the root directory, with the . and .. entries, using name to convert the file names
+func isoDirectory(entries []isoFile, root uint32, name func(string) []byte) []byte {
+	now := time.Now().UTC()
+	dir := []byte{}
+	dir = append(dir, isoDirRecord([]byte{0}, root, isoSectorSize, true, now)...)
+	dir = append(dir, isoDirRecord([]byte{1}, root, isoSectorSize, true, now)...)
+	for _, e := range entries {
+		dir = append(dir, isoDirRecord(name(e.name), e.sector, uint32(len(e.data)), false, now)...)
+	}
+	return dir
+}
+
+func isoDirRecord(id []byte, extent uint32, size uint32, isDir bool, now time.Time) []byte {
+	l := isoDirRecordBaseSize + len(id)
+	if l%2 == 1 {
+		l++
+	}
+	r := make([]byte, l)
+	r[0] = byte(l)
+	putBothEndian32(r[2:10], extent)
+	putBothEndian32(r[10:18], size)
+	r[18] = byte(now.Year() - 1900)
+	r[19] = byte(now.Month())
+	r[20] = byte(now.Day())
+	r[21] = byte(now.Hour())
+	r[22] = byte(now.Minute())
+	r[23] = byte(now.Second())
+	if isDir {
+		r[25] = 2
+	}
+	putBothEndian16(r[28:32], 1)
+	r[32] = byte(len(id))
+	copy(r[33:], id)
+	return r
+}
+
+// isoLevel1Name converts a file name to an ISO9660 level 1 name, eg. user-data becomes USER_DAT.;1
+func isoLevel1Name(name string) []byte {
+	base, ext := name, ""
+	if i := strings.LastIndex(name, "."); i > 0 {
+		base, ext = name[:i], name[i+1:]
+	}
+	clean := func(s string, max int) string {
+		res := strings.Map(func(r rune) rune {
+			switch {
+			case r >= 'a' && r <= 'z':
+				return r - 'a' + 'A'
+			case (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'):
+				return r
+			default:
+				return '_'
+			}
+		}, s)
+		if len(res) > max {
+			res = res[:max]
+		}
+		return res
+	}
+	return []byte(fmt.Sprintf("%s.%s;1", clean(base, 8), clean(ext, 3)))
+}
+
+func isoJolietName(name string) []byte {
+	return ucs2(name)
+}
+
+func ucs2(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(u))
+	for i, c := range u {
+		binary.BigEndian.PutUint16(b[2*i:], c)
+	}
+	return b
+}
+
+func putBothEndian16(b []byte, v uint16) {
+	binary.LittleEndian.PutUint16(b[0:2], v)
+	binary.BigEndian.PutUint16(b[2:4], v)
+}
+
+func putBothEndian32(b []byte, v uint32) {
+	binary.LittleEndian.PutUint32(b[0:4], v)
+	binary.BigEndian.PutUint32(b[4:8], v)
+}
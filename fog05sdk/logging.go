@@ -0,0 +1,133 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// LogHistorySize is the number of log records of a plugin kept in the store, older records are overwritten
+const LogHistorySize = 200
+
+// logQueueSize is the number of log records waiting to be published, records are dropped when it is full
+const logQueueSize = 256
+
+// PluginLogRecord represents a log record of a plugin published in the store
+type PluginLogRecord struct {
+	Sequence  int64             `json:"sequence"`
+	Timestamp int64             `json:"timestamp"`
+	Level     string            `json:"level"`
+	Message   string            `json:"message"`
+	Fields    map[string]string `json:"fields,omitempty"`
+}
+
+// SetLogger replaces the logger used by the SDK when no logger is injected
+func SetLogger(l log.FieldLogger) {
+	logger = l
+}
+
+// NewLogger returns a logger with the given level (panic, fatal, error, warn, info, debug or trace),
+// an empty level means info
+func NewLogger(level string) (*log.Logger, error) {
+	l := log.New()
+	if level == "" {
+		return l, nil
+	}
+	lvl, err := log.ParseLevel(level)
+	if err != nil {
+		return nil, &FError{"Invalid log level " + level, err}
+	}
+	l.SetLevel(lvl)
+	return l, nil
+}
+
+// StoreLogHook is a logrus hook publishing the log records of a plugin in the local actual store,
+// the records are published asynchronously so logging never waits for YAKS
+type StoreLogHook struct {
+	connector *YaksConnector
+	node      string
+	plugin    string
+	levels    []log.Level
+	queue     chan PluginLogRecord
+	sequence  int64
+	done      chan bool
+	stopped   chan bool
+	once      sync.Once
+}
+
+// NewStoreLogHook returns a hook publishing the records of the plugin with the given level or a more severe one
+func NewStoreLogHook(connector *YaksConnector, nodeid string, pluginid string, level log.Level) *StoreLogHook {
+	levels := []log.Level{}
+	for _, l := range log.AllLevels {
+		if l <= level {
+			levels = append(levels, l)
+		}
+	}
+	h := &StoreLogHook{connector: connector, node: nodeid, plugin: pluginid, levels: levels, queue: make(chan PluginLogRecord, logQueueSize), done: make(chan bool), stopped: make(chan bool)}
+	go h.publish()
+	return h
+}
+
+// Levels returns the levels of the records published by the hook
+func (h *StoreLogHook) Levels() []log.Level {
+	return h.levels
+}
+
+// Fire queues the record for publication
+func (h *StoreLogHook) Fire(entry *log.Entry) error {
+	rec := PluginLogRecord{Sequence: h.sequence, Timestamp: entry.Time.UnixNano(), Level: entry.Level.String(), Message: entry.Message, Fields: map[string]string{}}
+	for k, v := range entry.Data {
+		rec.Fields[k] = fmt.Sprintf("%v", v)
+	}
+	h.sequence++
+	select {
+	case h.queue <- rec:
+	default:
+	}
+	return nil
+}
+
+// Close stops the publication and waits for the record being published, the queued records are dropped
+func (h *StoreLogHook) Close() {
+	h.once.Do(func() {
+		close(h.done)
+		<-h.stopped
+	})
+}
+
+func (h *StoreLogHook) publish() {
+	defer close(h.stopped)
+	for {
+		select {
+		case <-h.done:
+			return
+		case rec := <-h.queue:
+			h.connector.Local.Actual.AddNodePluginLog(h.node, h.plugin, int(rec.Sequence%LogHistorySize), rec)
+		}
+	}
+}
+
+// sortLogRecords sorts the records by time, the sequence restarts with the plugin
+func sortLogRecords(records []PluginLogRecord) {
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Timestamp == records[j].Timestamp {
+			return records[i].Sequence < records[j].Sequence
+		}
+		return records[i].Timestamp < records[j].Timestamp
+	})
+}
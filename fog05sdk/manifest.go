@@ -0,0 +1,378 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Well known keys of the plugin configuration
+const (
+	// YLocatorKey is the configuration key for the YAKS locator
+	YLocatorKey string = "ylocator"
+
+	// YLocatorsKey is the configuration key for a list of YAKS locators used for failover
+	YLocatorsKey string = "ylocators"
+
+	// YLocatorPolicyKey is the configuration key for the YAKS locator selection policy
+	YLocatorPolicyKey string = "ylocator_policy"
+
+	// NodeIDKey is the configuration key for the node ID
+	NodeIDKey string = "nodeid"
+
+	// StateJournalKey is the configuration key for the directory of the local state journal
+	StateJournalKey string = "state_journal"
+
+	// TelemetryAddressKey is the configuration key for the address of the /metrics endpoint, eg. ":9105"
+	TelemetryAddressKey string = "telemetry_address"
+
+	// TraceFileKey is the configuration key for the file where the spans of the eval calls and handlers are written
+	TraceFileKey string = "trace_file"
+
+	// LogLevelKey is the configuration key for the log level of the plugin (error, warn, info, debug or trace)
+	LogLevelKey string = "log_level"
+
+	// LogPublishKey is the configuration key enabling the publication of the plugin logs in the local actual store
+	LogPublishKey string = "log_publish"
+
+	// AuditKey is the configuration key enabling the audit of the desired store writes and instance transitions of the plugin
+	AuditKey string = "audit"
+
+	// YUserKey is the configuration key for the user of the YAKS session
+	YUserKey string = "yuser"
+
+	// YPasswordKey is the configuration key for the password of the YAKS session, it must be a secret
+	// reference such as env:FOS_YAKS_PASSWORD or file:/etc/fos/yaks.passwd, plaintext passwords are rejected
+	YPasswordKey string = "ypassword"
+
+	// YTLSCertKey is the configuration key for the PEM client certificate used with the tls/ locators
+	YTLSCertKey string = "ytls_cert"
+
+	// YTLSKeyKey is the configuration key for the PEM key of the client certificate
+	YTLSKeyKey string = "ytls_key"
+
+	// YTLSCAKey is the configuration key for the PEM CA bundle used to verify the routers
+	YTLSCAKey string = "ytls_ca"
+)
+
+var requirementRegexp = regexp.MustCompile(`^\s*([A-Za-z0-9_\-\.]+)\s*(>=|<=|==|!=|>|<|=)?\s*([0-9]+(\.[0-9]+){0,2})?\s*$`)
+
+// Requirement represents a plugin requirement in the form <type or name>[<operator><version>], eg. os>=2
+type Requirement struct {
+	Name     string
+	Operator string
+	Version  string
+}
+
+// ParseRequirement parses a plugin requirement
+func ParseRequirement(req string) (*Requirement, error) {
+	m := requirementRegexp.FindStringSubmatch(req)
+	if m == nil || (m[2] == "") != (m[3] == "") {
+		return nil, &FError{"Invalid requirement: " + req, nil}
+	}
+	return &Requirement{Name: m[1], Operator: m[2], Version: m[3]}, nil
+}
+
+// String returns the requirement in its textual form
+func (r *Requirement) String() string {
+	return r.Name + r.Operator + r.Version
+}
+
+// Matches checks if the given plugin satisfies the requirement
+func (r *Requirement) Matches(pl Plugin) bool {
+	if pl.Type != r.Name && pl.Name != r.Name && pl.UUID != r.Name {
+		return false
+	}
+	if r.Operator == "" {
+		return true
+	}
+	c := compareVersions(strconv.Itoa(pl.Version), r.Version)
+	switch r.Operator {
+	case ">=":
+		return c >= 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case "<":
+		return c < 0
+	case "!=":
+		return c != 0
+	default:
+		return c == 0
+	}
+}
+
+// compareVersions compares two versions in the form major[.minor[.patch]], missing parts are considered 0
+func compareVersions(a string, b string) int {
+	pa := strings.Split(a, ".")
+	pb := strings.Split(b, ".")
+	for i := 0; i < 3; i++ {
+		va, vb := 0, 0
+		if i < len(pa) {
+			va, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			vb, _ = strconv.Atoi(pb[i])
+		}
+		if va != vb {
+			if va < vb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// LoadPluginManifest loads and validates a plugin manifest from a JSON or YAML file
+func LoadPluginManifest(path string) (*Plugin, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, &FError{"Unable to read manifest " + path, err}
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return ParsePluginManifestYAML(data)
+	default:
+		return ParsePluginManifest(data)
+	}
+}
+
+// ParsePluginManifest parses and validates a JSON plugin manifest
+func ParsePluginManifest(data []byte) (*Plugin, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	manifest := Plugin{}
+	err := dec.Decode(&manifest)
+	if err != nil {
+		return nil, &FError{"Invalid manifest", err}
+	}
+	err = manifest.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// ParsePluginManifestYAML parses and validates a YAML plugin manifest
+func ParsePluginManifestYAML(data []byte) (*Plugin, error) {
+	var generic interface{}
+	err := yaml.Unmarshal(data, &generic)
+	if err != nil {
+		return nil, &FError{"Invalid manifest", err}
+	}
+	generic, err = yamlToJSON(generic)
+	if err != nil {
+		return nil, &FError{"Invalid manifest", err}
+	}
+	js, err := json.Marshal(generic)
+	if err != nil {
+		return nil, &FError{"Invalid manifest", err}
+	}
+	return ParsePluginManifest(js)
+}
+
+// yamlToJSON converts the maps decoded by the YAML parser in maps usable by encoding/json
+func yamlToJSON(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for k, e := range t {
+			ks, ok := k.(string)
+			if !ok {
+				return nil, &FError{fmt.Sprintf("Invalid key %v, keys must be strings", k), nil}
+			}
+			c, err := yamlToJSON(e)
+			if err != nil {
+				return nil, err
+			}
+			m[ks] = c
+		}
+		return m, nil
+	case []interface{}:
+		for i, e := range t {
+			c, err := yamlToJSON(e)
+			if err != nil {
+				return nil, err
+			}
+			t[i] = c
+		}
+		return t, nil
+	default:
+		return v, nil
+	}
+}
+
+// Validate checks that the manifest contains all the mandatory fields and that the requirements are well formed
+func (pl *Plugin) Validate() error {
+	if pl.UUID == "" {
+		return &FError{"Invalid manifest: missing uuid", nil}
+	}
+	if pl.Name == "" {
+		return &FError{"Invalid manifest: missing name", nil}
+	}
+	if pl.Type == "" {
+		return &FError{"Invalid manifest: missing type", nil}
+	}
+	if pl.Version <= 0 {
+		return &FError{"Invalid manifest: version must be greater than 0", nil}
+	}
+	for _, r := range pl.Requirements {
+		_, err := ParseRequirement(r)
+		if err != nil {
+			return &FError{"Invalid manifest", err}
+		}
+	}
+	return nil
+}
+
+// ConfigValue returns the value of the given configuration key
+func (pl *Plugin) ConfigValue(key string) (interface{}, error) {
+	if pl.Configuration == nil {
+		return nil, &FError{"Missing configuration in manifest", nil}
+	}
+	v, found := (*pl.Configuration)[key]
+	if !found || v == nil {
+		return nil, &FError{"Missing configuration key: " + key, nil}
+	}
+	return v, nil
+}
+
+// ConfigString returns the value of the given configuration key as a string
+func (pl *Plugin) ConfigString(key string) (string, error) {
+	v, err := pl.ConfigValue(key)
+	if err != nil {
+		return "", err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", &FError{fmt.Sprintf("Configuration key %s is not a string", key), nil}
+	}
+	return s, nil
+}
+
+// ConfigInt returns the value of the given configuration key as an int
+func (pl *Plugin) ConfigInt(key string) (int, error) {
+	v, err := pl.ConfigValue(key)
+	if err != nil {
+		return 0, err
+	}
+	switch n := v.(type) {
+	case float64:
+		return int(n), nil
+	case int:
+		return n, nil
+	default:
+		return 0, &FError{fmt.Sprintf("Configuration key %s is not a number", key), nil}
+	}
+}
+
+// ConfigBool returns the value of the given configuration key as a bool
+func (pl *Plugin) ConfigBool(key string) (bool, error) {
+	v, err := pl.ConfigValue(key)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, &FError{fmt.Sprintf("Configuration key %s is not a boolean", key), nil}
+	}
+	return b, nil
+}
+
+// ConfigStringSlice returns the value of the given configuration key as a string slice
+func (pl *Plugin) ConfigStringSlice(key string) ([]string, error) {
+	v, err := pl.ConfigValue(key)
+	if err != nil {
+		return nil, err
+	}
+	l, ok := v.([]interface{})
+	if !ok {
+		return nil, &FError{fmt.Sprintf("Configuration key %s is not a list", key), nil}
+	}
+	res := []string{}
+	for _, e := range l {
+		s, ok := e.(string)
+		if !ok {
+			return nil, &FError{fmt.Sprintf("Configuration key %s is not a list of strings", key), nil}
+		}
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+// NodeID returns the node ID from the plugin configuration
+func (pl *Plugin) NodeID() (string, error) {
+	return pl.ConfigString(NodeIDKey)
+}
+
+// YLocators returns the YAKS locators from the plugin configuration,
+// ylocators takes precedence over ylocator
+func (pl *Plugin) YLocators() ([]string, error) {
+	locs, err := pl.ConfigStringSlice(YLocatorsKey)
+	if err == nil && len(locs) > 0 {
+		return locs, nil
+	}
+	loc, err := pl.ConfigString(YLocatorKey)
+	if err != nil {
+		return nil, err
+	}
+	return []string{loc}, nil
+}
+
+// ConnectorOptions returns the credentials and TLS options of the YAKS session from the plugin configuration,
+// the password is resolved by DefaultSecrets
+func (pl *Plugin) ConnectorOptions() (ConnectorOptions, error) {
+	opts := ConnectorOptions{}
+	if user, err := pl.ConfigString(YUserKey); err == nil {
+		opts.User = user
+	}
+	if ref, err := pl.ConfigString(YPasswordKey); err == nil {
+		if !DefaultSecrets.IsReference(ref) {
+			return opts, &FError{"Configuration key " + YPasswordKey + " must be a secret reference, eg. env:FOS_YAKS_PASSWORD", nil}
+		}
+		p, err := DefaultSecrets.Resolve(ref)
+		if err != nil {
+			return opts, err
+		}
+		opts.Password = p
+	}
+	tlsOpts := TLSOptions{}
+	tlsOpts.CertFile, _ = pl.ConfigString(YTLSCertKey)
+	tlsOpts.KeyFile, _ = pl.ConfigString(YTLSKeyKey)
+	tlsOpts.CAFile, _ = pl.ConfigString(YTLSCAKey)
+	if tlsOpts != (TLSOptions{}) {
+		opts.TLS = &tlsOpts
+	}
+	return opts, nil
+}
+
+// YLocatorPolicy returns the YAKS locator selection policy from the plugin configuration, PRIORITY if missing
+func (pl *Plugin) YLocatorPolicy() string {
+	p, err := pl.ConfigString(YLocatorPolicyKey)
+	if err != nil {
+		return PRIORITY
+	}
+	return p
+}
@@ -0,0 +1,329 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atolab/yaks-go"
+)
+
+// DefaultMetricsInterval is the default interval between two metrics samples of an instance
+const DefaultMetricsInterval = 10 * time.Second
+
+// MetricsHistorySize is the number of samples kept for each instance, older samples are overwritten
+const MetricsHistorySize = 60
+
+// FDUMetrics represents a resource usage sample of an FDU instance, the counters are cumulative
+// since the start of the instance
+type FDUMetrics struct {
+	InstanceID     string  `json:"instance_id"`
+	FDUID          string  `json:"fdu_id"`
+	NodeID         string  `json:"node_id"`
+	Timestamp      int64   `json:"timestamp"`
+	CPUTime        float64 `json:"cpu_time"`
+	MemoryBytes    uint64  `json:"memory_bytes"`
+	DiskReadBytes  uint64  `json:"disk_read_bytes"`
+	DiskWriteBytes uint64  `json:"disk_write_bytes"`
+	NetRxBytes     uint64  `json:"net_rx_bytes"`
+	NetTxBytes     uint64  `json:"net_tx_bytes"`
+}
+
+// MetricsAggregate is the aggregate of the samples of a set of instances between From and To,
+// CPUUsage is the average number of CPUs used, MemoryBytes the sum of the last samples
+// and the byte counters the sums of the increments in the interval
+type MetricsAggregate struct {
+	Instances      int     `json:"instances"`
+	From           int64   `json:"from"`
+	To             int64   `json:"to"`
+	CPUUsage       float64 `json:"cpu_usage"`
+	MemoryBytes    uint64  `json:"memory_bytes"`
+	DiskReadBytes  uint64  `json:"disk_read_bytes"`
+	DiskWriteBytes uint64  `json:"disk_write_bytes"`
+	NetRxBytes     uint64  `json:"net_rx_bytes"`
+	NetTxBytes     uint64  `json:"net_tx_bytes"`
+}
+
+// AggregateMetrics aggregates the samples of the instances, the samples can be in any order
+func AggregateMetrics(samples []FDUMetrics) MetricsAggregate {
+	byInstance := map[string][]FDUMetrics{}
+	for _, m := range samples {
+		byInstance[m.InstanceID] = append(byInstance[m.InstanceID], m)
+	}
+	agg := MetricsAggregate{Instances: len(byInstance)}
+	for _, series := range byInstance {
+		sort.Slice(series, func(i, j int) bool { return series[i].Timestamp < series[j].Timestamp })
+		first, last := series[0], series[len(series)-1]
+		if agg.From == 0 || first.Timestamp < agg.From {
+			agg.From = first.Timestamp
+		}
+		if last.Timestamp > agg.To {
+			agg.To = last.Timestamp
+		}
+		agg.MemoryBytes += last.MemoryBytes
+		if last.Timestamp > first.Timestamp {
+			agg.CPUUsage += (last.CPUTime - first.CPUTime) / float64(last.Timestamp-first.Timestamp)
+		}
+		agg.DiskReadBytes += counterDelta(first.DiskReadBytes, last.DiskReadBytes)
+		agg.DiskWriteBytes += counterDelta(first.DiskWriteBytes, last.DiskWriteBytes)
+		agg.NetRxBytes += counterDelta(first.NetRxBytes, last.NetRxBytes)
+		agg.NetTxBytes += counterDelta(first.NetTxBytes, last.NetTxBytes)
+	}
+	return agg
+}
+
+// counterDelta returns the increment of a counter, a counter reset by a restart of the instance counts from zero
+func counterDelta(first uint64, last uint64) uint64 {
+	if last < first {
+		return last
+	}
+	return last - first
+}
+
+// getMetrics returns the samples matching the selector sorted by timestamp
+func getMetrics(ws *yaksSession, s *yaks.Selector) ([]FDUMetrics, error) {
+	res := []FDUMetrics{}
+	for _, kv := range ws.Get(s) {
+		m := FDUMetrics{}
+		err := json.Unmarshal([]byte(kv.Value().ToString()), &m)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, m)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Timestamp < res[j].Timestamp })
+	return res, nil
+}
+
+// CgroupReader reads the metrics of the processes of BARE instances from their cgroup v2
+type CgroupReader struct {
+	// CgroupRoot is the mount point of the cgroup v2 hierarchy
+	CgroupRoot string
+	// ProcRoot is the mount point of proc, used to read the network counters of the processes
+	ProcRoot string
+}
+
+// NewCgroupReader returns a reader of the cgroup v2 hierarchy mounted in /sys/fs/cgroup
+func NewCgroupReader() *CgroupReader {
+	return &CgroupReader{CgroupRoot: "/sys/fs/cgroup", ProcRoot: "/proc"}
+}
+
+// ProcessCgroup returns the cgroup v2 of the process
+func (cr *CgroupReader) ProcessCgroup(pid int) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(cr.ProcRoot, strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "0::") {
+			return strings.TrimPrefix(line, "0::"), nil
+		}
+	}
+	return "", &FError{"Process " + strconv.Itoa(pid) + " is not in a cgroup v2", nil}
+}
+
+// Read returns the counters of the cgroup, the network counters are the ones of the network namespace
+// of the first process of the cgroup, excluding the loopback, for BARE processes it is the one of the node
+func (cr *CgroupReader) Read(cgroup string) (*FDUMetrics, error) {
+	dir := filepath.Join(cr.CgroupRoot, cgroup)
+	m := &FDUMetrics{Timestamp: time.Now().Unix()}
+
+	cpu, err := readKeyValues(filepath.Join(dir, "cpu.stat"))
+	if err != nil {
+		return nil, &FError{"Unable to read CPU usage of cgroup " + cgroup, err}
+	}
+	m.CPUTime = float64(cpu["usage_usec"]) / 1e6
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "memory.current"))
+	if err != nil {
+		return nil, &FError{"Unable to read memory usage of cgroup " + cgroup, err}
+	}
+	m.MemoryBytes, _ = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "io.stat")); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			for _, field := range strings.Fields(line) {
+				kv := strings.SplitN(field, "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				v, _ := strconv.ParseUint(kv[1], 10, 64)
+				switch kv[0] {
+				case "rbytes":
+					m.DiskReadBytes += v
+				case "wbytes":
+					m.DiskWriteBytes += v
+				}
+			}
+		}
+	}
+
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "cgroup.procs")); err == nil {
+		pids := strings.Fields(string(data))
+		if len(pids) > 0 {
+			m.NetRxBytes, m.NetTxBytes = cr.netCounters(pids[0])
+		}
+	}
+	return m, nil
+}
+
+// netCounters sums the received and transmitted bytes of the interfaces in /proc/<pid>/net/dev, except lo
+func (cr *CgroupReader) netCounters(pid string) (uint64, uint64) {
+	data, err := ioutil.ReadFile(filepath.Join(cr.ProcRoot, pid, "net", "dev"))
+	if err != nil {
+		return 0, 0
+	}
+	var rx, tx uint64
+	for _, line := range strings.Split(string(data), "\n") {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "lo" {
+			continue
+		}
+		fields := strings.Fields(kv[1])
+		if len(fields) < 9 {
+			continue
+		}
+		r, _ := strconv.ParseUint(fields[0], 10, 64)
+		t, _ := strconv.ParseUint(fields[8], 10, 64)
+		rx += r
+		tx += t
+	}
+	return rx, tx
+}
+
+// readKeyValues reads a file of "key value" lines
+func readKeyValues(path string) (map[string]uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	res := map[string]uint64{}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			res[fields[0]] = v
+		}
+	}
+	return res, nil
+}
+
+// metricsPublisher samples the instances of a runtime plugin every interval and publishes the samples
+// in the local actual store, in a ring of MetricsHistorySize slots for each instance, and in the global
+// actual store under the system and tenant of the instance once its record is there
+type metricsPublisher struct {
+	connector *YaksConnector
+	node      string
+	plugin    string
+	sample    func(string) (*FDUMetrics, error)
+	instances func() map[string]string
+	slots     map[string]int
+	scopes    map[string][2]string
+	done      chan bool
+	stopped   chan bool
+}
+
+// newMetricsPublisher returns a publisher, instances returns the FDU ID of each instance to sample
+func newMetricsPublisher(connector *YaksConnector, nodeid string, pluginid string, sample func(string) (*FDUMetrics, error), instances func() map[string]string) *metricsPublisher {
+	return &metricsPublisher{connector: connector, node: nodeid, plugin: pluginid, sample: sample, instances: instances, slots: map[string]int{}, scopes: map[string][2]string{}}
+}
+
+func (mp *metricsPublisher) start(interval time.Duration) {
+	mp.done = make(chan bool)
+	mp.stopped = make(chan bool)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-mp.done:
+				close(mp.stopped)
+				return
+			case <-ticker.C:
+				mp.publish()
+			}
+		}
+	}()
+}
+
+func (mp *metricsPublisher) stop() {
+	close(mp.done)
+	<-mp.stopped
+}
+
+func (mp *metricsPublisher) publish() {
+	instances := mp.instances()
+	for id := range mp.slots {
+		if _, found := instances[id]; !found {
+			delete(mp.slots, id)
+			delete(mp.scopes, id)
+		}
+	}
+	for id, fduid := range instances {
+		m, err := mp.sample(id)
+		if err != nil {
+			mp.connector.Logger().WithField("instance", id).Error("Unable to sample metrics: " + err.Error())
+			continue
+		}
+		m.InstanceID = id
+		m.FDUID = fduid
+		m.NodeID = mp.node
+		if m.Timestamp == 0 {
+			m.Timestamp = time.Now().Unix()
+		}
+		slot := mp.slots[id]
+		err = mp.connector.Local.Actual.AddNodeFDUInstanceMetrics(mp.node, mp.plugin, fduid, id, slot, *m)
+		if err != nil {
+			mp.connector.Logger().WithField("instance", id).Error("Unable to publish metrics: " + err.Error())
+			continue
+		}
+		mp.publishGlobal(fduid, id, slot, *m)
+		mp.slots[id] = (slot + 1) % MetricsHistorySize
+	}
+}
+
+// publishGlobal publishes the sample in the global actual store, the samples taken before
+// the record of the instance is in the global store are only in the local one
+func (mp *metricsPublisher) publishGlobal(fduid string, instanceid string, slot int, m FDUMetrics) {
+	scope, found := mp.scopes[instanceid]
+	if !found {
+		sysid, tenantid, err := mp.connector.Global.Actual.GetNodeFDUInstanceScope(mp.node, fduid, instanceid)
+		if err != nil {
+			return
+		}
+		scope = [2]string{sysid, tenantid}
+		mp.scopes[instanceid] = scope
+	}
+	err := mp.connector.Global.Actual.AddNodeFDUInstanceMetrics(scope[0], scope[1], mp.node, fduid, instanceid, slot, m)
+	if err != nil {
+		mp.connector.Logger().WithField("instance", instanceid).Error("Unable to publish metrics: " + err.Error())
+	}
+}
+
+// removeMetrics removes the metrics history of the instance from the local and global actual stores
+func removeMetrics(connector *YaksConnector, nodeid string, pluginid string, fduid string, instanceid string) {
+	connector.Local.Actual.RemoveNodeFDUInstanceMetrics(nodeid, pluginid, fduid, instanceid)
+	sysid, tenantid, err := connector.Global.Actual.GetNodeFDUInstanceScope(nodeid, fduid, instanceid)
+	if err == nil {
+		connector.Global.Actual.RemoveNodeFDUInstanceMetrics(sysid, tenantid, nodeid, fduid, instanceid)
+	}
+}
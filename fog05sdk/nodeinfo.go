@@ -0,0 +1,437 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultNodeStatusInterval is the default interval between two publications of the node status
+const DefaultNodeStatusInterval = 10 * time.Second
+
+// NodeCollector builds the NodeInfo and the NodeStatus of a node from /proc and /sys
+// and publishes them in the local actual store.
+// RAM sizes are in MB and disk sizes in GB
+type NodeCollector struct {
+	// Root is the directory containing proc and sys, it is / on a node and a fixture directory in tests
+	Root string
+	// Addrs returns the addresses of a network interface, by default they are read from the host
+	Addrs     func(string) ([]net.Addr, error)
+	connector *YaksConnector
+	node      string
+	mutex     sync.Mutex
+	published *NodeInfo
+	done      chan bool
+	stopped   chan bool
+}
+
+// nodeInfoMutex serializes the updates of the node information done in the process, YAKS has no
+// conditional writes so an update done at the same time by another process can still be lost
+var nodeInfoMutex sync.Mutex
+
+// updateNodeInformation applies f to the node information in the local actual store and writes it back
+func updateNodeInformation(connector *YaksConnector, nodeid string, f func(*NodeInfo) error) error {
+	nodeInfoMutex.Lock()
+	defer nodeInfoMutex.Unlock()
+	node, err := connector.Local.Actual.GetNodeInformation(nodeid)
+	if err != nil {
+		return err
+	}
+	err = f(node)
+	if err != nil {
+		return err
+	}
+	return connector.Local.Actual.AddNodeInformation(nodeid, *node)
+}
+
+// NewNodeCollector returns a collector for the given node reading from root, an empty root means /
+func NewNodeCollector(connector *YaksConnector, nodeid string, root string) *NodeCollector {
+	if root == "" {
+		root = "/"
+	}
+	return &NodeCollector{Root: root, Addrs: interfaceAddrs, connector: connector, node: nodeid}
+}
+
+// NodeInfo returns the node information read from the host, IO and accelerators are not collected
+func (nc *NodeCollector) NodeInfo() (*NodeInfo, error) {
+	info := &NodeInfo{UUID: nc.node, IO: []IOSpec{}, Accelerator: []AcceleratorSpec{}}
+	info.Name = nc.readString("proc/sys/kernel/hostname")
+	info.OS = nc.readString("proc/sys/kernel/ostype")
+	if info.OS == "" {
+		info.OS = strings.Title(runtime.GOOS)
+	}
+	cpus, err := nc.cpus()
+	if err != nil {
+		return nil, err
+	}
+	info.CPU = cpus
+	mem, err := nc.meminfo()
+	if err != nil {
+		return nil, err
+	}
+	info.RAM = RAMSpec{Size: float64(mem["MemTotal"]) / 1024}
+	disks, err := nc.disks()
+	if err != nil {
+		return nil, err
+	}
+	info.Disks = []DiskSpec{}
+	for _, d := range disks {
+		info.Disks = append(info.Disks, d.spec)
+	}
+	info.Network = nc.network()
+	return info, nil
+}
+
+// NodeStatus returns the node status read from the host, neighbors are not collected
+func (nc *NodeCollector) NodeStatus() (*NodeStatus, error) {
+	status := &NodeStatus{UUID: nc.node, Disk: []DiskStatus{}, Neighbors: []Neighbor{}}
+	mem, err := nc.meminfo()
+	if err != nil {
+		return nil, err
+	}
+	free, found := mem["MemAvailable"]
+	if !found {
+		free = mem["MemFree"] + mem["Buffers"] + mem["Cached"]
+	}
+	status.RAM = RAMStatus{Total: float64(mem["MemTotal"]) / 1024, Free: float64(free) / 1024}
+	disks, err := nc.disks()
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range disks {
+		status.Disk = append(status.Disk, d.status)
+	}
+	return status, nil
+}
+
+// PublishStatus collects and publishes the node status, keeping the neighbors already published
+func (nc *NodeCollector) PublishStatus() error {
+	status, err := nc.NodeStatus()
+	if err != nil {
+		return err
+	}
+	if old, err := nc.connector.Local.Actual.GetNodeStatus(nc.node); err == nil && old != nil {
+		status.Neighbors = old.Neighbors
+	}
+	return nc.connector.Local.Actual.AddNodeStatus(nc.node, *status)
+}
+
+// PublishInfo collects the node information and publishes it if it differs from the one last published,
+// the IO devices, the accelerators, the position and the volatility already published are kept.
+// It returns true if the information was published
+func (nc *NodeCollector) PublishInfo() (bool, error) {
+	info, err := nc.NodeInfo()
+	if err != nil {
+		return false, err
+	}
+	nc.mutex.Lock()
+	defer nc.mutex.Unlock()
+	if nc.published != nil && reflect.DeepEqual(*nc.published, *info) {
+		return false, nil
+	}
+	// the node information may not be published yet, so updateNodeInformation is not used
+	// but its mutex is held to not lose the updates of the devices and accelerators
+	nodeInfoMutex.Lock()
+	merged := *info
+	if old, err := nc.connector.Local.Actual.GetNodeInformation(nc.node); err == nil && old != nil {
+		merged.IO = old.IO
+		merged.Accelerator = old.Accelerator
+		merged.Position = old.Position
+		merged.Volatility = old.Volatility
+	}
+	err = nc.connector.Local.Actual.AddNodeInformation(nc.node, merged)
+	nodeInfoMutex.Unlock()
+	if err != nil {
+		return false, err
+	}
+	nc.published = info
+	return true, nil
+}
+
+// Start publishes the node status every interval, and the node information when it changes
+func (nc *NodeCollector) Start(interval time.Duration) {
+	if nc.done != nil {
+		return
+	}
+	nc.done = make(chan bool)
+	nc.stopped = make(chan bool)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := nc.PublishInfo(); err != nil {
+				nc.connector.Logger().WithField("node", nc.node).Error("Unable to publish node information: " + err.Error())
+			}
+			if err := nc.PublishStatus(); err != nil {
+				nc.connector.Logger().WithField("node", nc.node).Error("Unable to publish node status: " + err.Error())
+			}
+			select {
+			case <-nc.done:
+				close(nc.stopped)
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops the periodic publication
+func (nc *NodeCollector) Stop() {
+	if nc.done == nil {
+		return
+	}
+	close(nc.done)
+	<-nc.stopped
+	nc.done = nil
+}
+
+func (nc *NodeCollector) path(rel string) string {
+	return filepath.Join(nc.Root, rel)
+}
+
+func (nc *NodeCollector) readString(rel string) string {
+	data, err := ioutil.ReadFile(nc.path(rel))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// cpus reads a CPUSpec for each processor of /proc/cpuinfo, the frequency is the maximum one of cpufreq
+// since the current one of cpuinfo changes continuously, which is used only when cpufreq is not there
+func (nc *NodeCollector) cpus() ([]CPUSpec, error) {
+	data, err := ioutil.ReadFile(nc.path("proc/cpuinfo"))
+	if err != nil {
+		return nil, &FError{"Unable to read cpuinfo", err}
+	}
+	arch := nc.readString("proc/sys/kernel/arch")
+	if arch == "" {
+		arch = goArch()
+	}
+	// on ARM the model is in the Hardware field shared by all the processors
+	hardware := ""
+	res := []CPUSpec{}
+	for _, block := range strings.Split(string(data), "\n\n") {
+		fields := map[string]string{}
+		for _, line := range strings.Split(block, "\n") {
+			kv := strings.SplitN(line, ":", 2)
+			if len(kv) == 2 {
+				fields[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+			}
+		}
+		if h, found := fields["Hardware"]; found {
+			hardware = h
+		}
+		n, found := fields["processor"]
+		if !found {
+			continue
+		}
+		if _, err := strconv.Atoi(n); err != nil {
+			continue
+		}
+		cpu := CPUSpec{Model: fields["model name"], Arch: arch}
+		if cpu.Model == "" {
+			cpu.Model = fields["Processor"]
+		}
+		if khz, err := strconv.ParseFloat(nc.readString("sys/devices/system/cpu/cpu"+n+"/cpufreq/cpuinfo_max_freq"), 64); err == nil {
+			cpu.Frequency = khz / 1000
+		} else if mhz, err := strconv.ParseFloat(fields["cpu MHz"], 64); err == nil {
+			cpu.Frequency = mhz
+		}
+		res = append(res, cpu)
+	}
+	for i := range res {
+		if res[i].Model == "" {
+			res[i].Model = hardware
+		}
+	}
+	return res, nil
+}
+
+// meminfo returns the fields of /proc/meminfo in kB
+func (nc *NodeCollector) meminfo() (map[string]uint64, error) {
+	data, err := ioutil.ReadFile(nc.path("proc/meminfo"))
+	if err != nil {
+		return nil, &FError{"Unable to read meminfo", err}
+	}
+	res := map[string]uint64{}
+	for _, line := range strings.Split(string(data), "\n") {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		value := strings.Fields(kv[1])
+		if len(value) == 0 {
+			continue
+		}
+		if v, err := strconv.ParseUint(value[0], 10, 64); err == nil {
+			res[kv[0]] = v
+		}
+	}
+	return res, nil
+}
+
+type collectedDisk struct {
+	spec   DiskSpec
+	status DiskStatus
+}
+
+// disks returns the block devices mounted in /proc/mounts, a device mounted more than once is reported
+// at its first mount point, the sizes are read by statfs on the mount point under Root
+func (nc *NodeCollector) disks() ([]collectedDisk, error) {
+	data, err := ioutil.ReadFile(nc.path("proc/mounts"))
+	if err != nil {
+		return nil, &FError{"Unable to read mounts", err}
+	}
+	seen := map[string]bool{}
+	res := []collectedDisk{}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !strings.HasPrefix(fields[0], "/dev/") || seen[fields[0]] {
+			continue
+		}
+		seen[fields[0]] = true
+		var st syscall.Statfs_t
+		err := syscall.Statfs(nc.path(fields[1]), &st)
+		if err != nil {
+			continue
+		}
+		gb := float64(1024 * 1024 * 1024)
+		total := float64(uint64(st.Blocks)*uint64(st.Bsize)) / gb
+		free := float64(uint64(st.Bavail)*uint64(st.Bsize)) / gb
+		res = append(res, collectedDisk{
+			spec:   DiskSpec{LocalAddress: fields[0], Dimension: total, MountPoint: fields[1], FileSystem: fields[2]},
+			status: DiskStatus{MountPoint: fields[1], Total: total, Free: free},
+		})
+	}
+	return res, nil
+}
+
+// network returns the interfaces of /sys/class/net with the IPv4 default gateway of /proc/net/route
+func (nc *NodeCollector) network() []NetworkSpec {
+	res := []NetworkSpec{}
+	entries, err := ioutil.ReadDir(nc.path("sys/class/net"))
+	if err != nil {
+		return res
+	}
+	gateways := nc.gateways()
+	for _, e := range entries {
+		name := e.Name()
+		dir := filepath.Join("sys/class/net", name)
+		intf := NetworkSpec{InterfaceName: name, InterfaceMACAddress: nc.readString(filepath.Join(dir, "address")), Available: true}
+		if speed, err := strconv.Atoi(nc.readString(filepath.Join(dir, "speed"))); err == nil && speed > 0 {
+			intf.InterfaceSpeed = speed
+		}
+		switch {
+		case name == "lo":
+			intf.InterfaceType = "loopback"
+		case nc.exists(filepath.Join(dir, "wireless")):
+			intf.InterfaceType = "wireless"
+		case nc.exists(filepath.Join(dir, "bridge")):
+			intf.InterfaceType = "bridge"
+		case !nc.exists(filepath.Join(dir, "device")):
+			intf.InterfaceType = "virtual"
+		default:
+			intf.InterfaceType = "ethernet"
+		}
+		if gw, found := gateways[name]; found {
+			intf.DefaultGW = true
+			intf.InterfaceConf.IPV4Gateway = gw
+		}
+		if nc.Addrs != nil {
+			if addrs, err := nc.Addrs(name); err == nil {
+				for _, a := range addrs {
+					ipnet, ok := a.(*net.IPNet)
+					if !ok {
+						continue
+					}
+					mask := net.IP(ipnet.Mask).String()
+					if ip4 := ipnet.IP.To4(); ip4 != nil && intf.InterfaceConf.IPV4Address == "" {
+						intf.InterfaceConf.IPV4Address = ip4.String()
+						intf.InterfaceConf.IPV4Netmask = mask
+					} else if ip4 == nil && intf.InterfaceConf.IPV6Address == "" {
+						intf.InterfaceConf.IPV6Address = ipnet.IP.String()
+						intf.InterfaceConf.IPV6Netmask = mask
+					}
+				}
+			}
+		}
+		res = append(res, intf)
+	}
+	return res
+}
+
+// gateways returns the IPv4 default gateways of /proc/net/route by interface
+func (nc *NodeCollector) gateways() map[string]string {
+	res := map[string]string{}
+	data, err := ioutil.ReadFile(nc.path("proc/net/route"))
+	if err != nil {
+		return res
+	}
+	for _, line := range strings.Split(string(data), "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		gw, err := hex.DecodeString(fields[2])
+		if err != nil || len(gw) != 4 {
+			continue
+		}
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(gw))
+		res[fields[0]] = ip.String()
+	}
+	return res
+}
+
+func (nc *NodeCollector) exists(rel string) bool {
+	_, err := os.Lstat(nc.path(rel))
+	return err == nil
+}
+
+func interfaceAddrs(name string) ([]net.Addr, error) {
+	intf, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return intf.Addrs()
+}
+
+// goArch returns the machine name of the GOARCH, as reported by uname
+func goArch() string {
+	switch runtime.GOARCH {
+	case "amd64":
+		return "x86_64"
+	case "386":
+		return "i686"
+	case "arm64":
+		return "aarch64"
+	case "arm":
+		return "armv7l"
+	default:
+		return runtime.GOARCH
+	}
+}
@@ -0,0 +1,147 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"net"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestNodeCollectorNodeInfo(t *testing.T) {
+	root := writeFixture(t, map[string]string{
+		"proc/sys/kernel/hostname": "node0\n",
+		"proc/sys/kernel/ostype":   "Linux\n",
+		"proc/sys/kernel/arch":     "x86_64\n",
+		"proc/cpuinfo": "processor\t: 0\nmodel name\t: Intel(R) Xeon(R) CPU\ncpu MHz\t\t: 1200.000\n\n" +
+			"processor\t: 1\nmodel name\t: Intel(R) Xeon(R) CPU\ncpu MHz\t\t: 1800.000\n",
+		"sys/devices/system/cpu/cpu0/cpufreq/cpuinfo_max_freq": "3400000\n",
+		"proc/meminfo": "MemTotal:        8388608 kB\nMemFree:         1048576 kB\nMemAvailable:    4194304 kB\n",
+		"proc/mounts":  "/dev/sda1 / ext4 rw 0 0\nproc /proc proc rw 0 0\n/dev/sda1 /var ext4 rw 0 0\n",
+		"proc/net/route": "Iface\tDestination\tGateway\tFlags\n" +
+			"eth0\t00000000\t0102A8C0\t0003\neth0\t0002A8C0\t00000000\t0001\n",
+		"sys/class/net/lo/address":          "00:00:00:00:00:00\n",
+		"sys/class/net/eth0/address":        "52:54:00:12:34:56\n",
+		"sys/class/net/eth0/speed":          "1000\n",
+		"sys/class/net/eth0/device/uevent":  "DRIVER=e1000\n",
+		"sys/class/net/wlan0/address":       "52:54:00:ab:cd:ef\n",
+		"sys/class/net/wlan0/speed":         "-1\n",
+		"sys/class/net/wlan0/device/uevent": "DRIVER=iwlwifi\n",
+		"sys/class/net/wlan0/wireless/link": "0\n",
+		"sys/class/net/docker0/bridge/stp":  "0\n",
+		"sys/class/net/veth0/address":       "52:54:00:00:00:01\n",
+	})
+	defer os.RemoveAll(root)
+
+	nc := NewNodeCollector(nil, "node0", root)
+	nc.Addrs = func(name string) ([]net.Addr, error) {
+		if name != "eth0" {
+			return nil, nil
+		}
+		return []net.Addr{
+			&net.IPNet{IP: net.ParseIP("fe80::1"), Mask: net.CIDRMask(64, 128)},
+			&net.IPNet{IP: net.ParseIP("192.168.2.10"), Mask: net.CIDRMask(24, 32)},
+		}, nil
+	}
+	info, err := nc.NodeInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.UUID != "node0" || info.Name != "node0" || info.OS != "Linux" {
+		t.Fatalf("unexpected node %s %s %s", info.UUID, info.Name, info.OS)
+	}
+	cpus := []CPUSpec{
+		{Model: "Intel(R) Xeon(R) CPU", Frequency: 3400, Arch: "x86_64"},
+		{Model: "Intel(R) Xeon(R) CPU", Frequency: 1800, Arch: "x86_64"},
+	}
+	if !reflect.DeepEqual(info.CPU, cpus) {
+		t.Fatalf("unexpected CPUs %+v", info.CPU)
+	}
+	if info.RAM.Size != 8192 {
+		t.Fatalf("unexpected RAM %f", info.RAM.Size)
+	}
+	if len(info.Disks) != 1 || info.Disks[0].LocalAddress != "/dev/sda1" || info.Disks[0].MountPoint != "/" ||
+		info.Disks[0].FileSystem != "ext4" || info.Disks[0].Dimension <= 0 {
+		t.Fatalf("unexpected disks %+v", info.Disks)
+	}
+
+	types := map[string]string{}
+	for _, intf := range info.Network {
+		types[intf.InterfaceName] = intf.InterfaceType
+		if intf.InterfaceName != "eth0" {
+			continue
+		}
+		if intf.InterfaceMACAddress != "52:54:00:12:34:56" || intf.InterfaceSpeed != 1000 || !intf.DefaultGW {
+			t.Fatalf("unexpected interface %+v", intf)
+		}
+		conf := intf.InterfaceConf
+		if conf.IPV4Address != "192.168.2.10" || conf.IPV4Netmask != "255.255.255.0" || conf.IPV4Gateway != "192.168.2.1" || conf.IPV6Address != "fe80::1" {
+			t.Fatalf("unexpected interface configuration %+v", conf)
+		}
+	}
+	expected := map[string]string{"lo": "loopback", "eth0": "ethernet", "wlan0": "wireless", "docker0": "bridge", "veth0": "virtual"}
+	if !reflect.DeepEqual(types, expected) {
+		t.Fatalf("unexpected interfaces %v", types)
+	}
+}
+
+func TestNodeCollectorARMCPUs(t *testing.T) {
+	root := writeFixture(t, map[string]string{
+		"proc/sys/kernel/arch": "armv7l\n",
+		"proc/cpuinfo": "processor\t: 0\nBogoMIPS\t: 38.40\n\nprocessor\t: 1\nBogoMIPS\t: 38.40\n\n" +
+			"Hardware\t: BCM2835\nRevision\t: a02082\n",
+		"proc/meminfo": "MemTotal:        1024000 kB\nMemFree:          512000 kB\n",
+		"proc/mounts":  "",
+	})
+	defer os.RemoveAll(root)
+
+	cpus, err := NewNodeCollector(nil, "node0", root).cpus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []CPUSpec{{Model: "BCM2835", Arch: "armv7l"}, {Model: "BCM2835", Arch: "armv7l"}}
+	if !reflect.DeepEqual(cpus, expected) {
+		t.Fatalf("unexpected CPUs %+v", cpus)
+	}
+}
+
+func TestNodeCollectorNodeStatus(t *testing.T) {
+	root := writeFixture(t, map[string]string{
+		"proc/meminfo": "MemTotal:        2097152 kB\nMemFree:          262144 kB\nBuffers:          131072 kB\nCached:           131072 kB\n",
+		"proc/mounts":  "/dev/vda1 / ext4 rw 0 0\n/dev/vdb1 /missing xfs rw 0 0\n",
+	})
+	defer os.RemoveAll(root)
+
+	status, err := NewNodeCollector(nil, "node0", root).NodeStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// without MemAvailable the free memory is MemFree, Buffers and Cached
+	if status.RAM.Total != 2048 || status.RAM.Free != 512 {
+		t.Fatalf("unexpected RAM %+v", status.RAM)
+	}
+	if len(status.Disk) != 1 || status.Disk[0].MountPoint != "/" || status.Disk[0].Free > status.Disk[0].Total {
+		t.Fatalf("unexpected disks %+v", status.Disk)
+	}
+}
+
+func TestNodeCollectorMissingProc(t *testing.T) {
+	root := writeFixture(t, map[string]string{})
+	defer os.RemoveAll(root)
+
+	if _, err := NewNodeCollector(nil, "node0", root).NodeInfo(); err == nil {
+		t.Fatal("expected an error without cpuinfo")
+	}
+}
@@ -1002,6 +1002,7 @@ type FOSPlugin struct {
 	OS        *OS
 	Agent     *Agent
 	UUID      string
+	heartbeat *heartbeatPublisher
 }
 
 // NewPlugin returns a new FOSPlugin object
@@ -1023,7 +1024,7 @@ func (pl *FOSPlugin) GetOSPlugin() bool {
 		if err != nil {
 			panic(err.Error())
 		}
-		if pld.Type == "os" {
+		if pld.Type == OSPLUGIN {
 			pl.OS = &OS{uuid: pld.UUID, connector: pl.connector, node: pl.node}
 			return true
 		}
@@ -1042,7 +1043,7 @@ func (pl *FOSPlugin) GetNMPlugin() bool {
 		if err != nil {
 			panic(err.Error())
 		}
-		if pld.Type == "network" {
+		if pld.Type == NETWORKPLUGIN {
 			pl.NM = &NM{uuid: pld.UUID, connector: pl.connector, node: pl.node}
 			return true
 		}
@@ -1061,7 +1062,7 @@ func (pl *FOSPlugin) GetAgent() bool {
 		if err != nil {
 			panic(err.Error())
 		}
-		if pld.Type == "network" {
+		if pld.Type == AGENTPLUGIN {
 			pl.Agent = &Agent{connector: pl.connector, node: pl.node}
 			return true
 		}
@@ -1087,11 +1088,12 @@ func (pl *FOSPlugin) GetNodeConfiguration() (*NodeConfiguration, error) {
 	return c, nil
 }
 
-// GetPluginState returns the plugin state, retrives it from YAKS, as a map[string]interface, each implementation of the plugin can have his own state representation
+// GetPluginState returns the plugin state, retrives it from YAKS, as a map[string]interface, each implementation of the plugin can have his own state representation.
+// An empty state is returned if the plugin has no state, use StateStore for a typed and versioned state
 func (pl *FOSPlugin) GetPluginState() map[string]interface{} {
 	s, err := pl.connector.Local.Actual.GetNodePluginState(pl.node, pl.UUID)
 	if err != nil {
-		panic(err.Error())
+		return map[string]interface{}{}
 	}
 	return *s
 }
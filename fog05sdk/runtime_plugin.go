@@ -1,10 +1,15 @@
 package fog05sdk
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"sync"
 	"time"
 
+	"github.com/atolab/yaks-go"
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 )
@@ -64,6 +69,37 @@ type FOSRuntimePluginInterface interface {
 	GetFileFDU(string, *string) EvalResult
 }
 
+// FOSRuntimeExecInterface can be implemented by runtime plugins to execute commands inside the instances
+// and to attach to their console
+type FOSRuntimeExecInterface interface {
+
+	//ExecFDU executes a command inside the given FDU instance
+	ExecFDU(string, ExecRequest) (ExecProcess, error)
+
+	//AttachFDU attaches to the console of the given FDU instance, the command of the request is ignored
+	AttachFDU(string, ExecRequest) (ExecProcess, error)
+}
+
+// FOSRuntimeStreamInterface can be implemented by runtime plugins to stream logs and files of the instances
+// in chunks, instead of replying with a single EvalResult
+type FOSRuntimeStreamInterface interface {
+
+	//StreamLogFDU returns a reader on the log of the given FDU instance, if follow is true
+	//the reader returns the new log lines until it is closed
+	StreamLogFDU(string, bool) (io.ReadCloser, error)
+
+	//StreamFileFDU returns a reader on the given file of the given FDU instance
+	StreamFileFDU(string, string) (io.ReadCloser, error)
+}
+
+// FOSRuntimeMetricsInterface can be implemented by runtime plugins to publish the resource usage of the instances,
+// BARE runtimes can use a CgroupReader
+type FOSRuntimeMetricsInterface interface {
+
+	//FDUMetrics returns the resource usage counters of the given FDU instance
+	FDUMetrics(string) (*FDUMetrics, error)
+}
+
 // FOSRuntimePluginAbstract represents a Runtime Plugin for Eclipse fog05
 type FOSRuntimePluginAbstract struct {
 	Pid           int
@@ -71,46 +107,291 @@ type FOSRuntimePluginAbstract struct {
 	Connector     *YaksConnector
 	Node          string
 	Configuration map[string]interface{}
-	Logger        *log.Logger
+	// Logger is the logger of the plugin, PluginLogger adds to its entries the node, plugin and name fields
+	Logger    *log.Logger
+	Discovery *PluginDiscovery
+	// DependencyTimeout bounds the wait for the plugin dependencies in Start, zero means no timeout
+	DependencyTimeout time.Duration
+	// HeartbeatInterval is the interval between two heartbeats, DefaultHeartbeatInterval if zero
+	HeartbeatInterval time.Duration
+	// OnDependencyLost is called when one of the plugin dependencies disappears from the node,
+	// the plugin can use it to pause or to exit cleanly
+	OnDependencyLost func(string, Plugin)
+	// ShutdownPolicy decides, for each instance, if it has to be stopped (SHUTDOWNSTOP)
+	// or left running (SHUTDOWNLEAVE) when the plugin shuts down, if nil instances are left running
+	ShutdownPolicy func(FDURecord) string
+	// ShutdownTimeout bounds the shutdown triggered by a signal, DefaultShutdownTimeout if zero
+	ShutdownTimeout time.Duration
+	// State is the versioned state of the plugin, the defined instances are recorded in it
+	State *StateStore
+	// OnRecover is called in Start for each instance recorded in the state, the plugin re-adopts
+	// the instance and returns nil, or returns an error and the instance is removed from the state
+	OnRecover func(FDURecord) error
+	// Storage, if not nil, provisions the storage of the instances: volumes are created on DEFINE, from the storage
+	// descriptors of the FDU if the record has no storage, attached on CONFIGURE, detached on CLEAN and deleted on UNDEFINE,
+	// the paths of the attached volumes are recorded in the storage records of the instance
+	Storage *StorageManager
+	// Devices, if not nil, allocates the IO devices of the instances on DEFINE and CONFIGURE
+	// and releases them on CLEAN and UNDEFINE, the plugin gets their paths by Devices.Devices.
+	// The allocations are saved in the plugin state and restored by Start
+	Devices *DeviceAllocator
+	// Accelerators, if not nil, assigns the accelerators of the instances on DEFINE and releases them on UNDEFINE,
+	// the plugin gets them in the hypervisor info of the record or by Accelerators.Assigned.
+	// The assignments are saved in the plugin state and restored by Start
+	Accelerators *AcceleratorManager
+	// MetricsInterval is the interval between two metrics samples of the instances, DefaultMetricsInterval if zero,
+	// metrics are published only if the plugin implements FOSRuntimeMetricsInterface
+	MetricsInterval time.Duration
+	metrics         *metricsPublisher
+	// TelemetryAddress, if not empty, is the address where the SDK metrics are served on /metrics in OpenMetrics format
+	TelemetryAddress string
+	telemetry        *http.Server
+	traces           SpanExporter
+	logs             *StoreLogHook
+	requirements     []string
+	watching         bool
+	desiredSid       *yaks.SubscriptionID
+	mutex            sync.Mutex
+	stopping         bool
+	closed           bool
 	FOSRuntimePluginInterface
 	FOSPlugin
 }
 
 // NewFOSRuntimePluginAbstract returns a new FOSRuntimePluginFDU object
 func NewFOSRuntimePluginAbstract(name string, version int, pluginid string, manifest Plugin) (*FOSRuntimePluginAbstract, error) {
+	return NewFOSRuntimePluginAbstractWithLogger(name, version, pluginid, manifest, nil)
+}
+
+// NewFOSRuntimePluginAbstractWithLogger returns a new FOSRuntimePluginFDU object logging through base,
+// if base is nil a new logger is created with the level in the manifest
+func NewFOSRuntimePluginAbstractWithLogger(name string, version int, pluginid string, manifest Plugin, base *log.Logger) (*FOSRuntimePluginAbstract, error) {
 	if pluginid == "" {
 		pluginid = uuid.UUID.String(uuid.New())
 	}
 	pl := NewPlugin(version, pluginid)
 
+	locators, err := manifest.YLocators()
+	if err != nil {
+		return nil, err
+	}
+	nodeid, err := manifest.NodeID()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range manifest.Requirements {
+		_, err := ParseRequirement(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if base == nil {
+		level, _ := manifest.ConfigString(LogLevelKey)
+		base, err = NewLogger(level)
+		if err != nil {
+			return nil, err
+		}
+	}
+	rtlog := pluginLogger(base, nodeid, pluginid, name)
+
+	opts, err := manifest.ConnectorOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts.Logger = rtlog
+
 	conf := *manifest.Configuration
-	// json.Unmarshal([]byte(manifest.Configuration), &conf)
-	con, err := NewYaksConnector(conf["ylocator"].(string))
+	con, err := NewYaksConnectorWithOptions(locators, manifest.YLocatorPolicy(), opts)
 	if err != nil {
 		return nil, err
 	}
 	pl.connector = con
-	pl.node = conf["nodeid"].(string)
+	pl.node = nodeid
+
+	// the agent is waited separately since it may not publish a plugin record
+	reqs := append([]string{OSPLUGIN, NETWORKPLUGIN}, manifest.Requirements...)
+
+	journal, _ := manifest.ConfigString(StateJournalKey)
+	state := NewStateStore(con, nodeid, pluginid, journal)
+	telemetry, _ := manifest.ConfigString(TelemetryAddressKey)
+
+	var traces SpanExporter
+	if file, err := manifest.ConfigString(TraceFileKey); err == nil && file != "" {
+		traces, err = NewOTLPFileExporter(file, name)
+		if err != nil {
+			con.Close()
+			return nil, err
+		}
+		con.SetTracer(NewTracer(traces))
+	}
 
-	return &FOSRuntimePluginAbstract{Pid: os.Getpid(), Name: name, Connector: con, Node: conf["nodeid"].(string), FOSPlugin: *pl, Logger: log.New(), Configuration: conf}, nil
+	if audit, err := manifest.ConfigBool(AuditKey); err == nil && audit {
+		con.EnableAudit(pluginid)
+	}
+
+	var logs *StoreLogHook
+	if publish, err := manifest.ConfigBool(LogPublishKey); err == nil && publish {
+		logs = NewStoreLogHook(con, nodeid, pluginid, base.GetLevel())
+		base.AddHook(logs)
+	}
+
+	return &FOSRuntimePluginAbstract{Pid: os.Getpid(), Name: name, Connector: con, Node: nodeid, FOSPlugin: *pl, Logger: base, Configuration: conf, State: state, TelemetryAddress: telemetry, traces: traces, logs: logs, requirements: reqs}, nil
 }
 
 // Start starts the Plugin and calls StartRuntime of FOSRuntimePluginInterface
 func (rt *FOSRuntimePluginAbstract) Start() {
-	rt.WaitDependencies()
-	rt.Connector.Local.Desired.ObserveNodeRuntimeFDU(rt.Node, rt.FOSPlugin.UUID, rt.react)
-	err := rt.FOSRuntimePluginInterface.StartRuntime()
+	ctx := context.Background()
+	if rt.DependencyTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rt.DependencyTimeout)
+		defer cancel()
+	}
+	err := rt.WaitDependenciesContext(ctx)
+	if err != nil {
+		rt.PluginLogger().Error(fmt.Sprintf("Plugin dependencies not available %s", err.Error()))
+		rt.Close()
+		return
+	}
+	if rt.Devices != nil {
+		err = rt.Devices.Restore(rt.State)
+		if err != nil {
+			rt.PluginLogger().Error(fmt.Sprintf("Unable to restore device allocations %s", err.Error()))
+		}
+	}
+	if rt.Accelerators != nil {
+		err = rt.Accelerators.Restore(rt.State)
+		if err != nil {
+			rt.PluginLogger().Error(fmt.Sprintf("Unable to restore accelerator assignments %s", err.Error()))
+		}
+	}
+	sid, err := rt.Connector.Local.Desired.ObserveNodeRuntimeFDU(rt.Node, rt.FOSPlugin.UUID, rt.react)
 	if err != nil {
-		rt.Logger.Error(fmt.Sprintf("Plugin StartRuntime returned error %s", err.Error()))
+		rt.PluginLogger().Error(fmt.Sprintf("Unable to observe desired state %s", err.Error()))
 		rt.Close()
+		return
+	}
+	rt.desiredSid = sid
+	err = rt.FOSRuntimePluginInterface.StartRuntime()
+	if err != nil {
+		rt.PluginLogger().Error(fmt.Sprintf("Plugin StartRuntime returned error %s", err.Error()))
+		rt.Close()
+		return
+	}
+	rt.recover()
+	interval := rt.HeartbeatInterval
+	if interval <= 0 {
+		interval = DefaultHeartbeatInterval
+	}
+	rt.FOSPlugin.StartHeartbeat(interval, nil, rt.countInstances)
+	rt.startMetrics()
+	if rt.TelemetryAddress != "" {
+		srv, err := DefaultTelemetry.ServeTelemetry(rt.TelemetryAddress)
+		if err != nil {
+			rt.PluginLogger().Error(fmt.Sprintf("Unable to serve telemetry %s", err.Error()))
+		}
+		rt.telemetry = srv
+	}
+}
+
+// startMetrics starts sampling the instances recorded in the state if the plugin implements FOSRuntimeMetricsInterface
+func (rt *FOSRuntimePluginAbstract) startMetrics() {
+	m, ok := rt.FOSRuntimePluginInterface.(FOSRuntimeMetricsInterface)
+	if !ok {
+		return
+	}
+	interval := rt.MetricsInterval
+	if interval <= 0 {
+		interval = DefaultMetricsInterval
+	}
+	instances := func() map[string]string {
+		res := map[string]string{}
+		rec, err := rt.State.Record()
+		if err != nil {
+			return res
+		}
+		for id, record := range rec.Instances {
+			res[id] = record.FDUID
+		}
+		return res
+	}
+	rt.metrics = newMetricsPublisher(rt.Connector, rt.Node, rt.FOSPlugin.UUID, m.FDUMetrics, instances)
+	rt.metrics.start(interval)
+}
+
+// recover re-adopts the instances recorded in the state through OnRecover
+// and registers their evals, instances that cannot be re-adopted are removed from the state
+func (rt *FOSRuntimePluginAbstract) recover() {
+	if rt.OnRecover == nil {
+		return
+	}
+	rec, err := rt.State.Record()
+	if err != nil {
+		rt.PluginLogger().Error(fmt.Sprintf("Unable to load plugin state %s", err.Error()))
+		return
+	}
+	for id, record := range rec.Instances {
+		err := rt.OnRecover(record)
+		if err == nil {
+			err = rt.addInstanceEvals(record.FDUID, id)
+		}
+		if err != nil {
+			rt.PluginLogger().Error(fmt.Sprintf("Unable to recover instance %s %s", id, err.Error()))
+			rt.releaseDevices(id)
+			rt.releaseAccelerators(id)
+			rt.State.RemoveInstance(id)
+			continue
+		}
+		rt.PluginLogger().Info(fmt.Sprintf("Recovered instance %s", id))
 	}
 }
 
 // Close closes the Plugin, called by FOSRuntimePluginInterface.StopRuntime()
 func (rt *FOSRuntimePluginAbstract) Close() {
+	rt.mutex.Lock()
+	if rt.closed {
+		rt.mutex.Unlock()
+		return
+	}
+	rt.closed = true
+	rt.mutex.Unlock()
+
+	rt.FOSPlugin.StopHeartbeat()
+	if rt.metrics != nil {
+		rt.metrics.stop()
+	}
+	if rt.telemetry != nil {
+		rt.telemetry.Close()
+	}
+	if rt.Discovery != nil {
+		rt.Discovery.Close()
+	}
+	// the log publication is stopped by RemovePlugin, before the connector is closed
 	rt.RemovePlugin()
 	rt.Connector.Close()
-	rt.Logger.Info("Plugin closed")
+	if rt.traces != nil {
+		rt.traces.Close()
+	}
+	rt.PluginLogger().Info("Plugin closed")
+}
+
+// PluginLogger returns the logger of the plugin with the node, plugin and name fields
+func (rt *FOSRuntimePluginAbstract) PluginLogger() log.FieldLogger {
+	return pluginLogger(rt.Logger, rt.Node, rt.FOSPlugin.UUID, rt.Name)
+}
+
+// InstanceLogger returns the logger of the plugin with the fdu and instance fields
+func (rt *FOSRuntimePluginAbstract) InstanceLogger(fduid string, instanceid string) log.FieldLogger {
+	return rt.PluginLogger().WithFields(log.Fields{"fdu": fduid, "instance": instanceid})
+}
+
+// pluginLogger adds the node, plugin and name fields to base, the SDK logger is used if base is nil
+func pluginLogger(base *log.Logger, nodeid string, pluginid string, name string) log.FieldLogger {
+	fields := log.Fields{"node": nodeid, "plugin": pluginid, "name": name}
+	if base == nil {
+		return logger.WithFields(fields)
+	}
+	return base.WithFields(fields)
 }
 
 // WaitDestinationReady waits for the destination node of a migration to be ready
@@ -120,19 +401,67 @@ func (rt *FOSRuntimePluginAbstract) WaitDestinationReady(fduid string, instancei
 
 // WaitDependencies waits that the Agent, OS and NM Plugins are up and gets those from YAKS
 func (rt *FOSRuntimePluginAbstract) WaitDependencies() {
-	for rt.FOSPlugin.Agent == nil {
-		rt.FOSPlugin.GetAgent()
-		time.Sleep(1 * time.Second)
+	err := rt.WaitDependenciesContext(context.Background())
+	if err != nil {
+		rt.PluginLogger().Error(fmt.Sprintf("Plugin dependencies not available %s", err.Error()))
+	}
+}
+
+// WaitDependenciesContext waits that the Agent, OS, NM Plugins and the requirements in the plugin manifest are up,
+// the wait can be bounded using the context deadline
+func (rt *FOSRuntimePluginAbstract) WaitDependenciesContext(ctx context.Context) error {
+	if rt.Discovery == nil {
+		pd, err := NewPluginDiscovery(rt.Connector, rt.Node)
+		if err != nil {
+			return err
+		}
+		rt.Discovery = pd
+	}
+
+	err := rt.waitAgent(ctx)
+	if err != nil {
+		return err
 	}
-	for rt.FOSPlugin.OS == nil {
-		rt.FOSPlugin.GetOSPlugin()
-		time.Sleep(1 * time.Second)
+	deps, err := rt.Discovery.Wait(ctx, rt.requirements)
+	if err != nil {
+		return err
+	}
+	rt.FOSPlugin.Agent = &Agent{connector: rt.Connector, node: rt.Node}
+	rt.FOSPlugin.OS = &OS{uuid: deps[OSPLUGIN].UUID, connector: rt.Connector, node: rt.Node}
+	rt.FOSPlugin.NM = &NM{uuid: deps[NETWORKPLUGIN].UUID, connector: rt.Connector, node: rt.Node}
+
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+	if !rt.watching {
+		rt.watching = true
+		rt.Discovery.Watch(rt.requirements, rt.dependencyLost)
 	}
-	for rt.FOSPlugin.NM == nil {
-		rt.FOSPlugin.GetNMPlugin()
-		time.Sleep(1 * time.Second)
+	return nil
+}
+
+// waitAgent waits that the agent is up, it is found by its plugin record if it publishes one,
+// otherwise by the node information it publishes
+func (rt *FOSRuntimePluginAbstract) waitAgent(ctx context.Context) error {
+	for {
+		if len(rt.Discovery.Find(AGENTPLUGIN)) > 0 {
+			return nil
+		}
+		if _, err := rt.Connector.Local.Actual.GetNodeInformation(rt.Node); err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return &FError{"Agent not available: " + ctx.Err().Error(), nil}
+		case <-time.After(time.Second):
+		}
 	}
+}
 
+func (rt *FOSRuntimePluginAbstract) dependencyLost(requirement string, info Plugin) {
+	rt.PluginLogger().Warn(fmt.Sprintf("Plugin dependency %s lost, plugin %s (%s) disappeared", requirement, info.Name, info.UUID))
+	if rt.OnDependencyLost != nil {
+		rt.OnDependencyLost(requirement, info)
+	}
 }
 
 // WriteFDUError given an fdu id, instance id, error number and error message, stores the error in YAKS
@@ -142,11 +471,15 @@ func (rt *FOSRuntimePluginAbstract) WriteFDUError(fduid string, instanceid strin
 		return err
 	}
 
+	previous := *record
 	record.Status = ERROR
 	record.ErrorCode = &errno
 	record.ErrorMsg = &errmsg
 
 	err = rt.Connector.Local.Actual.AddNodeFDU(rt.Node, rt.FOSPlugin.UUID, fduid, instanceid, *record)
+	if err == nil {
+		rt.auditTransition(&previous, record)
+	}
 	return err
 }
 
@@ -157,9 +490,13 @@ func (rt *FOSRuntimePluginAbstract) UpdateFDUStatus(fduid string, instanceid str
 		return err
 	}
 
+	previous := *record
 	record.Status = status
 
 	err = rt.Connector.Local.Actual.AddNodeFDU(rt.Node, rt.FOSPlugin.UUID, fduid, instanceid, *record)
+	if err == nil {
+		rt.auditTransition(&previous, record)
+	}
 	return err
 }
 
@@ -174,8 +511,12 @@ func (rt *FOSRuntimePluginAbstract) RegisterPlugin(manifest *Plugin) {
 	rt.Connector.Local.Actual.AddNodePlugin(rt.Node, rt.FOSPlugin.UUID, *manifest)
 }
 
-// RemovePlugin removes the plugin in the node
+// RemovePlugin removes the plugin in the node with its published logs, the publication of the logs is stopped
 func (rt *FOSRuntimePluginAbstract) RemovePlugin() {
+	if rt.logs != nil {
+		rt.logs.Close()
+		rt.Connector.Local.Actual.RemoveNodePluginLogs(rt.Node, rt.FOSPlugin.UUID)
+	}
 	rt.Connector.Local.Actual.RemoveNodePlugin(rt.Node, rt.FOSPlugin.UUID)
 }
 
@@ -191,11 +532,15 @@ func (rt *FOSRuntimePluginAbstract) GetFDURecord(instanceid string) (*FDURecord,
 
 // AddFDURecord adds an FDU record to the node
 func (rt *FOSRuntimePluginAbstract) AddFDURecord(instanceid string, info *FDURecord) error {
-	// record, err := rt.Connector.Local.Actual.GetNodeFDU(rt.Node, rt.FOSPlugin.UUID, info.FDUID, instanceid)
-	// if err != nil {
-	// 	return err
-	// }
-	return rt.Connector.Local.Actual.AddNodeFDU(rt.Node, rt.FOSPlugin.UUID, info.FDUID, instanceid, *info)
+	var previous *FDURecord
+	if rt.Connector.Auditor() != nil {
+		previous, _ = rt.Connector.Local.Actual.GetNodeFDU(rt.Node, rt.FOSPlugin.UUID, info.FDUID, instanceid)
+	}
+	err := rt.Connector.Local.Actual.AddNodeFDU(rt.Node, rt.FOSPlugin.UUID, info.FDUID, instanceid, *info)
+	if err == nil {
+		rt.auditTransition(previous, info)
+	}
+	return err
 }
 
 // RemoveFDURecord removes an FDURecord from the node
@@ -204,21 +549,244 @@ func (rt *FOSRuntimePluginAbstract) RemoveFDURecord(instanceid string) error {
 	if err != nil {
 		return err
 	}
-	return rt.Connector.Local.Actual.RemoveNodeFDU(rt.Node, rt.FOSPlugin.UUID, record.FDUID, instanceid)
+	err = rt.Connector.Local.Actual.RemoveNodeFDU(rt.Node, rt.FOSPlugin.UUID, record.FDUID, instanceid)
+	if err == nil {
+		removed := *record
+		removed.Status = UNDEFINE
+		rt.auditTransition(record, &removed)
+	}
+	return err
+}
+
+// addInstanceEvals registers the start, run, log, ls and get evals of the given instance,
+// the exec and attach evals if the plugin implements FOSRuntimeExecInterface
+// and the stream evals if the plugin implements FOSRuntimeStreamInterface,
+// they call the corresponding functions of the plugin
+func (rt *FOSRuntimePluginAbstract) addInstanceEvals(fduid string, instanceid string) error {
+	lad := &rt.Connector.Local.Actual
+	err := lad.AddPluginFDUStartEval(rt.Node, rt.FOSPlugin.UUID, fduid, instanceid, func(env *string) EvalResult {
+		return rt.FOSRuntimePluginInterface.StartFDU(instanceid, env)
+	})
+	if err == nil {
+		err = lad.AddPluginFDURunEval(rt.Node, rt.FOSPlugin.UUID, fduid, instanceid, func(env *string) EvalResult {
+			return rt.FOSRuntimePluginInterface.RunFDU(instanceid, env)
+		})
+	}
+	if err == nil {
+		err = lad.AddPluginFDULogEval(rt.Node, rt.FOSPlugin.UUID, fduid, instanceid, func(arg *string) EvalResult {
+			return rt.FOSRuntimePluginInterface.GetLogFDU(instanceid, arg)
+		})
+	}
+	if err == nil {
+		err = lad.AddPluginFDULsEval(rt.Node, rt.FOSPlugin.UUID, fduid, instanceid, func(arg *string) EvalResult {
+			return rt.FOSRuntimePluginInterface.LsFDU(instanceid, arg)
+		})
+	}
+	if err == nil {
+		err = lad.AddPluginFDUFileEval(rt.Node, rt.FOSPlugin.UUID, fduid, instanceid, func(filename *string) EvalResult {
+			return rt.FOSRuntimePluginInterface.GetFileFDU(instanceid, filename)
+		})
+	}
+	executor, ok := rt.FOSRuntimePluginInterface.(FOSRuntimeExecInterface)
+	if err == nil && ok {
+		err = lad.AddPluginFDUExecEval(rt.Node, rt.FOSPlugin.UUID, fduid, instanceid, func(req ExecRequest) EvalResult {
+			proc, err := executor.ExecFDU(instanceid, req)
+			return rt.startSession(fduid, instanceid, proc, err)
+		})
+	}
+	if err == nil && ok {
+		err = lad.AddPluginFDUAttachEval(rt.Node, rt.FOSPlugin.UUID, fduid, instanceid, func(req ExecRequest) EvalResult {
+			proc, err := executor.AttachFDU(instanceid, req)
+			return rt.startSession(fduid, instanceid, proc, err)
+		})
+	}
+	streamer, ok := rt.FOSRuntimePluginInterface.(FOSRuntimeStreamInterface)
+	if err == nil && ok {
+		err = lad.AddPluginFDULogStreamEval(rt.Node, rt.FOSPlugin.UUID, fduid, instanceid, func(follow bool) EvalResult {
+			r, err := streamer.StreamLogFDU(instanceid, follow)
+			return rt.startTransfer(fduid, instanceid, r, err)
+		})
+	}
+	if err == nil && ok {
+		err = lad.AddPluginFDUFileStreamEval(rt.Node, rt.FOSPlugin.UUID, fduid, instanceid, func(filename *string) EvalResult {
+			r, err := streamer.StreamFileFDU(instanceid, *filename)
+			return rt.startTransfer(fduid, instanceid, r, err)
+		})
+	}
+	if err != nil {
+		rt.removeInstanceEvals(fduid, instanceid)
+		return err
+	}
+	return nil
+}
+
+// removeInstanceEvals removes the evals registered by addInstanceEvals
+func (rt *FOSRuntimePluginAbstract) removeInstanceEvals(fduid string, instanceid string) {
+	lad := &rt.Connector.Local.Actual
+	lad.RemovePluginFDUStartEval(rt.Node, rt.FOSPlugin.UUID, fduid, instanceid)
+	lad.RemovePluginFDURunEval(rt.Node, rt.FOSPlugin.UUID, fduid, instanceid)
+	lad.RemovePluginFDULogEval(rt.Node, rt.FOSPlugin.UUID, fduid, instanceid)
+	lad.RemovePluginFDULsEval(rt.Node, rt.FOSPlugin.UUID, fduid, instanceid)
+	lad.RemovePluginFDUFileEval(rt.Node, rt.FOSPlugin.UUID, fduid, instanceid)
+	if _, ok := rt.FOSRuntimePluginInterface.(FOSRuntimeExecInterface); ok {
+		lad.RemovePluginFDUExecEval(rt.Node, rt.FOSPlugin.UUID, fduid, instanceid)
+		lad.RemovePluginFDUAttachEval(rt.Node, rt.FOSPlugin.UUID, fduid, instanceid)
+	}
+	if _, ok := rt.FOSRuntimePluginInterface.(FOSRuntimeStreamInterface); ok {
+		lad.RemovePluginFDULogStreamEval(rt.Node, rt.FOSPlugin.UUID, fduid, instanceid)
+		lad.RemovePluginFDUFileStreamEval(rt.Node, rt.FOSPlugin.UUID, fduid, instanceid)
+	}
+}
+
+// startTransfer starts sending the reader as a chunked transfer of the given instance
+// and replies with the path of the transfer
+func (rt *FOSRuntimePluginAbstract) startTransfer(fduid string, instanceid string, r io.ReadCloser, err error) EvalResult {
+	if err != nil {
+		code := 5 // EIO
+		msg := err.Error()
+		return EvalResult{Error: &code, ErrorMessage: &msg}
+	}
+	lad := &rt.Connector.Local.Actual
+	tid := uuid.UUID.String(uuid.New())
+	path := lad.GetNodeFDUTransferPath(rt.Node, rt.FOSPlugin.UUID, fduid, instanceid, tid).ToString()
+	go func() {
+		err := sendTransfer(lad.ws, path, tid, r)
+		if err != nil {
+			rt.PluginLogger().Error(fmt.Sprintf("Transfer %s of instance %s failed %s", tid, instanceid, err.Error()))
+		}
+	}()
+	return EvalResult{Result: &path}
+}
+
+// startSession connects the process to a new exec session of the given instance
+// and replies with the path of the session
+func (rt *FOSRuntimePluginAbstract) startSession(fduid string, instanceid string, proc ExecProcess, err error) EvalResult {
+	if err != nil {
+		code := 5 // EIO
+		msg := err.Error()
+		return EvalResult{Error: &code, ErrorMessage: &msg}
+	}
+	lad := &rt.Connector.Local.Actual
+	sid := uuid.UUID.String(uuid.New())
+	path := lad.GetNodeFDUSessionPath(rt.Node, rt.FOSPlugin.UUID, fduid, instanceid, sid).ToString()
+	go func() {
+		err := serveExecSession(lad.ws, path, sid, proc)
+		if err != nil {
+			rt.PluginLogger().Error(fmt.Sprintf("Session %s of instance %s failed %s", sid, instanceid, err.Error()))
+		}
+	}()
+	return EvalResult{Result: &path}
 }
 
 func (rt *FOSRuntimePluginAbstract) react(info FDURecord) {
+	if rt.isStopping() {
+		rt.PluginLogger().Warn(fmt.Sprintf("Plugin is shutting down, ignoring %s for instance %s", info.Status, info.UUID))
+		return
+	}
 
 	action := info.Status
 	id := info.UUID
+	l := rt.InstanceLogger(info.FDUID, id)
+	telemetryTransitions.add(1, []string{rt.FOSPlugin.UUID, action})
 	switch action {
 	case DEFINE:
-		rt.DefineFDU(info)
+		if rt.Storage != nil {
+			rt.storageFromDescriptor(&info)
+			err := rt.Storage.Provision(&info)
+			if err != nil {
+				l.Error(fmt.Sprintf("Unable to provision storage of instance %s %s", id, err.Error()))
+				return
+			}
+		}
+		if rt.Devices != nil {
+			_, err := rt.Devices.Allocate(info)
+			if err != nil {
+				l.Error(fmt.Sprintf("Unable to allocate devices of instance %s %s", id, err.Error()))
+				rt.releaseStorage(id)
+				return
+			}
+		}
+		if rt.Accelerators != nil {
+			_, err := rt.Accelerators.Assign(&info)
+			if err != nil {
+				l.Error(fmt.Sprintf("Unable to assign accelerators of instance %s %s", id, err.Error()))
+				rt.releaseDevices(id)
+				rt.releaseStorage(id)
+				return
+			}
+		}
+		err := rt.DefineFDU(info)
+		if err != nil {
+			l.Error(fmt.Sprintf("Unable to define instance %s %s", id, err.Error()))
+			rt.releaseAccelerators(id)
+			rt.releaseDevices(id)
+			rt.releaseStorage(id)
+			return
+		}
+		err = rt.addInstanceEvals(info.FDUID, id)
+		if err != nil {
+			l.Error(fmt.Sprintf("Unable to register evals for instance %s %s", id, err.Error()))
+		}
+		err = rt.State.AddInstance(info)
+		if err != nil {
+			l.Error(fmt.Sprintf("Unable to record instance %s in state %s", id, err.Error()))
+		}
+		rt.countInstances()
 	case UNDEFINE:
-		rt.UndefineFDU(id)
+		err := rt.UndefineFDU(id)
+		if err != nil {
+			l.Error(fmt.Sprintf("Unable to undefine instance %s %s", id, err.Error()))
+			return
+		}
+		rt.removeInstanceEvals(info.FDUID, id)
+		removeMetrics(rt.Connector, rt.Node, rt.FOSPlugin.UUID, info.FDUID, id)
+		rt.releaseAccelerators(id)
+		rt.releaseDevices(id)
+		rt.releaseStorage(id)
+		err = rt.State.RemoveInstance(id)
+		if err != nil {
+			l.Error(fmt.Sprintf("Unable to remove instance %s from state %s", id, err.Error()))
+		}
+		rt.countInstances()
 	case CLEAN:
 		rt.CleanFDU(id)
+		rt.releaseDevices(id)
+		if rt.Storage != nil {
+			err := rt.Storage.Detach(id)
+			if err != nil {
+				l.Error(fmt.Sprintf("Unable to detach storage of instance %s %s", id, err.Error()))
+			}
+			// the volumes not detached keep their path
+			paths := map[string]string{}
+			for _, v := range rt.Storage.Volumes(id) {
+				if v.Path != nil {
+					paths[v.Record.StorageID] = *v.Path
+				}
+			}
+			err = rt.recordStoragePaths(info.FDUID, id, paths)
+			if err != nil {
+				l.Error(fmt.Sprintf("Unable to record storage paths of instance %s %s", id, err.Error()))
+			}
+		}
 	case CONFIGURE:
+		if rt.Devices != nil {
+			_, err := rt.Devices.Allocate(info)
+			if err != nil {
+				l.Error(fmt.Sprintf("Unable to allocate devices of instance %s %s", id, err.Error()))
+				return
+			}
+		}
+		if rt.Storage != nil {
+			paths, err := rt.Storage.Attach(id)
+			if err != nil {
+				l.Error(fmt.Sprintf("Unable to attach storage of instance %s %s", id, err.Error()))
+				return
+			}
+			err = rt.recordStoragePaths(info.FDUID, id, paths)
+			if err != nil {
+				l.Error(fmt.Sprintf("Unable to record storage paths of instance %s %s", id, err.Error()))
+			}
+		}
 		rt.ConfigureFDU(id)
 	case STOP:
 		rt.StopFDU(id)
@@ -231,6 +799,87 @@ func (rt *FOSRuntimePluginAbstract) react(info FDURecord) {
 	case TAKEOFF:
 		rt.MigrateFDU(id)
 	default:
-		rt.Logger.Error(fmt.Sprintf("Action %s not recognized", action))
+		l.Error(fmt.Sprintf("Action %s not recognized", action))
+	}
+}
+
+// countInstances returns the number of instances of the plugin and updates the instances gauge
+func (rt *FOSRuntimePluginAbstract) countInstances() int {
+	n := len(rt.FOSRuntimePluginInterface.GetFDUs())
+	telemetryInstances.set(float64(n), []string{rt.FOSPlugin.UUID})
+	return n
+}
+
+// storageFromDescriptor fills the storage records of an instance without them from the storage descriptors
+// of its FDU, the instance is defined without storage if the descriptor is not available
+func (rt *FOSRuntimePluginAbstract) storageFromDescriptor(info *FDURecord) {
+	if len(info.Storage) > 0 || rt.FOSPlugin.Agent == nil {
+		return
+	}
+	fdu, err := rt.GetFDUDescriptor(info.FDUID, info.UUID)
+	if err != nil {
+		rt.InstanceLogger(info.FDUID, info.UUID).Warn(fmt.Sprintf("Unable to get descriptor of instance %s %s", info.UUID, err.Error()))
+		return
+	}
+	info.Storage = StorageRecordsFromDescriptors(fdu.Storage)
+}
+
+// recordStoragePaths writes in the storage records of the instance the paths of the attached volumes,
+// indexed by storage ID, the records without a path are detached
+func (rt *FOSRuntimePluginAbstract) recordStoragePaths(fduid string, instanceid string, paths map[string]string) error {
+	record, err := rt.Connector.Local.Actual.GetNodeFDU(rt.Node, rt.FOSPlugin.UUID, fduid, instanceid)
+	if err != nil {
+		return err
+	}
+	for i := range record.Storage {
+		s := &record.Storage[i]
+		s.Path = nil
+		if path, found := paths[s.StorageID]; found {
+			s.Path = &path
+		}
+	}
+	return rt.Connector.Local.Actual.AddNodeFDU(rt.Node, rt.FOSPlugin.UUID, fduid, instanceid, *record)
+}
+
+func (rt *FOSRuntimePluginAbstract) releaseStorage(instanceid string) {
+	if rt.Storage == nil {
+		return
+	}
+	err := rt.Storage.Release(instanceid)
+	if err != nil {
+		rt.PluginLogger().Error(fmt.Sprintf("Unable to release storage of instance %s %s", instanceid, err.Error()))
+	}
+}
+
+func (rt *FOSRuntimePluginAbstract) releaseDevices(instanceid string) {
+	if rt.Devices == nil {
+		return
+	}
+	err := rt.Devices.Release(instanceid)
+	if err != nil {
+		rt.PluginLogger().Error(fmt.Sprintf("Unable to release devices of instance %s %s", instanceid, err.Error()))
+	}
+}
+
+func (rt *FOSRuntimePluginAbstract) releaseAccelerators(instanceid string) {
+	if rt.Accelerators == nil {
+		return
+	}
+	err := rt.Accelerators.Release(instanceid)
+	if err != nil {
+		rt.PluginLogger().Error(fmt.Sprintf("Unable to release accelerators of instance %s %s", instanceid, err.Error()))
+	}
+}
+
+// auditTransition records in the audit log, if audit is enabled on the connector, the write of record
+// in the local actual store, previous is the record it replaced, nil if there was none
+func (rt *FOSRuntimePluginAbstract) auditTransition(previous *FDURecord, record *FDURecord) {
+	a := rt.Connector.Auditor()
+	if a == nil {
+		return
+	}
+	err := a.RecordTransition(rt.Node, rt.FOSPlugin.UUID, previous, *record)
+	if err != nil {
+		rt.PluginLogger().Error(fmt.Sprintf("Unable to audit transition of instance %s %s", record.UUID, err.Error()))
 	}
 }
@@ -0,0 +1,336 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/atolab/yaks-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// TLSLocatorPrefix is the prefix of the locators of YAKS routers reachable through TLS, eg. tls/192.168.1.1:7448.
+// The router has to be behind a TLS terminator forwarding to its TCP locator, the connector tunnels the session
+// through a local TCP endpoint since the YAKS client only supports TCP, the endpoint accepts only the connections
+// of the connector process, identified through /proc
+const TLSLocatorPrefix string = "tls/"
+
+// SecretsProvider returns secrets by name
+type SecretsProvider interface {
+	Secret(name string) (string, error)
+}
+
+// EnvSecrets provides the secrets from environment variables, the name is the variable
+type EnvSecrets struct{}
+
+// Secret returns the value of the environment variable
+func (EnvSecrets) Secret(name string) (string, error) {
+	v, found := os.LookupEnv(name)
+	if !found {
+		return "", &FError{"Environment variable " + name + " not set", nil}
+	}
+	return v, nil
+}
+
+// FileSecrets provides the secrets from files, the name is the path of the file,
+// relative paths are relative to Dir. Trailing new lines are removed
+type FileSecrets struct {
+	Dir string
+}
+
+// Secret returns the content of the file
+func (fs FileSecrets) Secret(name string) (string, error) {
+	path := name
+	if !filepath.IsAbs(path) && fs.Dir != "" {
+		path = filepath.Join(fs.Dir, path)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", &FError{"Unable to read secret file " + path, err}
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// SecretResolver resolves references in the form <provider>:<name>, eg. env:FOS_YAKS_PASSWORD
+// or file:/etc/fos/yaks.passwd
+type SecretResolver map[string]SecretsProvider
+
+// DefaultSecrets resolves the env and file references
+var DefaultSecrets = SecretResolver{"env": EnvSecrets{}, "file": FileSecrets{}}
+
+// IsReference returns true if the value is a reference to a known provider
+func (sr SecretResolver) IsReference(value string) bool {
+	kv := strings.SplitN(value, ":", 2)
+	if len(kv) != 2 {
+		return false
+	}
+	_, found := sr[kv[0]]
+	return found
+}
+
+// Resolve returns the secret referenced by ref
+func (sr SecretResolver) Resolve(ref string) (string, error) {
+	kv := strings.SplitN(ref, ":", 2)
+	if len(kv) != 2 {
+		return "", &FError{"Invalid secret reference, expected <provider>:<name>", nil}
+	}
+	p, found := sr[kv[0]]
+	if !found {
+		return "", &FError{"Secret provider not recognized: " + kv[0], nil}
+	}
+	return p.Secret(kv[1])
+}
+
+// TLSOptions are the client certificate and CA bundle used to reach the routers with a tls/ locator
+type TLSOptions struct {
+	// CertFile and KeyFile are the PEM client certificate and key, both empty if no client certificate is used
+	CertFile string
+	KeyFile  string
+	// CAFile is the PEM bundle of the CAs of the routers, the system CAs if empty
+	CAFile string
+	// ServerName overrides the name checked in the router certificate, the host of the locator if empty
+	ServerName string
+}
+
+// Config returns the TLS configuration of the options
+func (o *TLSOptions) Config() (*tls.Config, error) {
+	conf := &tls.Config{ServerName: o.ServerName, MinVersion: tls.VersionTLS12}
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, &FError{"Unable to load client certificate", err}
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	if o.CAFile != "" {
+		data, err := ioutil.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, &FError{"Unable to read CA bundle " + o.CAFile, err}
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, &FError{"No certificate found in CA bundle " + o.CAFile, nil}
+		}
+		conf.RootCAs = pool
+	}
+	return conf, nil
+}
+
+// ConnectorOptions are the options of the connection of a YaksConnector to the routers
+type ConnectorOptions struct {
+	// User and Password are the credentials of the YAKS session, not used if User is empty
+	User     string
+	Password string
+	// TLS is used for the tls/ locators, if nil they use the system CAs and no client certificate
+	TLS *TLSOptions
+	// Logger is the logger of the connector, the SDK logger if nil
+	Logger log.FieldLogger
+}
+
+// properties returns the properties of the YAKS login
+func (o *ConnectorOptions) properties() yaks.Properties {
+	if o.User == "" {
+		return nil
+	}
+	return yaks.Properties{yaks.PropUser: o.User, yaks.PropPassword: o.Password}
+}
+
+// tlsConfig returns the TLS configuration for the tls/ locators
+func (o *ConnectorOptions) tlsConfig() (*tls.Config, error) {
+	if o.TLS == nil {
+		return &tls.Config{MinVersion: tls.VersionTLS12}, nil
+	}
+	return o.TLS.Config()
+}
+
+// NewConnectorOptions returns the options with the credentials of the agent configuration,
+// the password can be a secret reference resolved by DefaultSecrets
+func NewConnectorOptions(conf AgentConfiguration) (ConnectorOptions, error) {
+	opts := ConnectorOptions{}
+	if conf.User != nil {
+		opts.User = *conf.User
+	}
+	if conf.Password != nil {
+		opts.Password = *conf.Password
+		if DefaultSecrets.IsReference(opts.Password) {
+			p, err := DefaultSecrets.Resolve(opts.Password)
+			if err != nil {
+				return opts, err
+			}
+			opts.Password = p
+		}
+	}
+	return opts, nil
+}
+
+// tlsTunnel forwards a single connection accepted on a local TCP endpoint to a router over TLS,
+// a new tunnel is created for each login
+type tlsTunnel struct {
+	listener net.Listener
+	address  string
+	config   *tls.Config
+	mutex    sync.Mutex
+	conns    map[net.Conn]bool
+	closed   bool
+}
+
+// newTLSTunnel checks that the router is reachable over TLS and starts forwarding
+func newTLSTunnel(address string, config *tls.Config) (*tlsTunnel, error) {
+	conf := config.Clone()
+	if conf.ServerName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, &FError{"Invalid TLS locator address " + address, err}
+		}
+		conf.ServerName = host
+	}
+	c, err := tls.Dial("tcp", address, conf)
+	if err != nil {
+		return nil, &FError{"TLS handshake with " + address + " failed", err}
+	}
+	c.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	t := &tlsTunnel{listener: l, address: address, config: conf, conns: map[net.Conn]bool{}}
+	go t.serve()
+	return t, nil
+}
+
+// locator returns the TCP locator of the local endpoint
+func (t *tlsTunnel) locator() string {
+	return "tcp/" + t.listener.Addr().String()
+}
+
+// serve forwards the connection of the YAKS login, and then closes the listener so that no other local process
+// can use the client certificate of the connector through the tunnel. Connections opened by other processes
+// are closed, the peer is identified by its socket in /proc, so the tunnel is available only on Linux.
+// Other processes of the node can still connect while the login is in progress, delaying it, and the traffic
+// between the YAKS client and the local endpoint is in clear on the loopback interface
+func (t *tlsTunnel) serve() {
+	for {
+		local, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		if peerInProcess("/proc", local.LocalAddr(), local.RemoteAddr()) {
+			t.listener.Close()
+			t.forward(local)
+			return
+		}
+		logger.WithField("peer", local.RemoteAddr().String()).Warn("TLS tunnel connection from another process rejected")
+		local.Close()
+	}
+}
+
+// peerInProcess checks, from the TCP sockets in proc, that the connection from peer to local
+// has been opened by this process
+func peerInProcess(proc string, local net.Addr, peer net.Addr) bool {
+	l, ok := local.(*net.TCPAddr)
+	p, ok2 := peer.(*net.TCPAddr)
+	if !ok || !ok2 {
+		return false
+	}
+	data, err := ioutil.ReadFile(filepath.Join(proc, "net", "tcp"))
+	if err != nil {
+		return false
+	}
+	// the socket of the peer has the port of the peer as local address and the endpoint as remote address
+	inode := ""
+	for _, line := range strings.Split(string(data), "\n") {
+		f := strings.Fields(line)
+		if len(f) > 9 && strings.HasSuffix(f[1], fmt.Sprintf(":%04X", p.Port)) && strings.HasSuffix(f[2], fmt.Sprintf(":%04X", l.Port)) {
+			inode = f[9]
+			break
+		}
+	}
+	if inode == "" || inode == "0" {
+		return false
+	}
+	fds, err := ioutil.ReadDir(filepath.Join(proc, "self", "fd"))
+	if err != nil {
+		return false
+	}
+	for _, fd := range fds {
+		target, err := os.Readlink(filepath.Join(proc, "self", "fd", fd.Name()))
+		if err == nil && target == "socket:["+inode+"]" {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *tlsTunnel) track(c net.Conn) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closed {
+		c.Close()
+		return false
+	}
+	t.conns[c] = true
+	return true
+}
+
+func (t *tlsTunnel) forward(local net.Conn) {
+	if !t.track(local) {
+		return
+	}
+	remote, err := tls.Dial("tcp", t.address, t.config)
+	if err != nil {
+		logger.WithFields(log.Fields{"address": t.address, "error": err}).Warn("TLS tunnel unable to reach router")
+		local.Close()
+		return
+	}
+	if !t.track(remote) {
+		local.Close()
+		return
+	}
+	done := make(chan bool, 2)
+	pipe := func(dst net.Conn, src net.Conn) {
+		io.Copy(dst, src)
+		done <- true
+	}
+	go pipe(remote, local)
+	go pipe(local, remote)
+	<-done
+	local.Close()
+	remote.Close()
+	t.mutex.Lock()
+	delete(t.conns, local)
+	delete(t.conns, remote)
+	t.mutex.Unlock()
+}
+
+func (t *tlsTunnel) close() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closed {
+		return
+	}
+	t.closed = true
+	t.listener.Close()
+	for c := range t.conns {
+		c.Close()
+	}
+}
@@ -0,0 +1,143 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const (
+	// SHUTDOWNSTOP stops the instance when the plugin shuts down
+	SHUTDOWNSTOP string = "STOP"
+
+	// SHUTDOWNLEAVE leaves the instance running when the plugin shuts down
+	SHUTDOWNLEAVE string = "LEAVE"
+)
+
+// DefaultShutdownTimeout is the default deadline for a shutdown triggered by a signal
+const DefaultShutdownTimeout = 30 * time.Second
+
+// WaitForShutdown blocks until SIGINT or SIGTERM is received and then shuts down the plugin
+// within ShutdownTimeout
+func (rt *FOSRuntimePluginAbstract) WaitForShutdown() error {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	sig := <-sigs
+	rt.PluginLogger().Info(fmt.Sprintf("Received %s, shutting down", sig.String()))
+
+	timeout := rt.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return rt.Shutdown(ctx)
+}
+
+// Shutdown gracefully shuts down the plugin: it stops accepting new desired state events,
+// stops or leaves running each instance according to ShutdownPolicy, removes the instances evals,
+// saves the plugin state, calls StopRuntime and closes the connector.
+// When the context is done Shutdown returns, the remaining steps are skipped and the plugin
+// is closed as soon as the step in progress completes
+func (rt *FOSRuntimePluginAbstract) Shutdown(ctx context.Context) error {
+	rt.mutex.Lock()
+	if rt.stopping {
+		rt.mutex.Unlock()
+		return &FError{"Plugin already shutting down", nil}
+	}
+	rt.stopping = true
+	rt.mutex.Unlock()
+
+	if rt.desiredSid != nil {
+		err := rt.Connector.Local.Desired.Unsubscribe(rt.desiredSid)
+		if err != nil {
+			rt.PluginLogger().Warn(fmt.Sprintf("Unable to stop observing desired state %s", err.Error()))
+		}
+		rt.desiredSid = nil
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- rt.drain(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		rt.Close()
+		return err
+	case <-ctx.Done():
+		rt.PluginLogger().Error("Shutdown deadline exceeded, closing the plugin")
+		// the connector is still in use by the step in progress, it is closed once drain returns
+		go func() {
+			<-done
+			rt.Close()
+		}()
+		return &FError{"Shutdown deadline exceeded", ctx.Err()}
+	}
+}
+
+// drain stops or leaves running the instances, removes their evals, records all the instances
+// in the state, so that they are recovered on restart, and stops the runtime.
+// The instances stopped are recorded as configured
+func (rt *FOSRuntimePluginAbstract) drain(ctx context.Context) error {
+	instances := rt.FOSRuntimePluginInterface.GetFDUs()
+	recorded := map[string]FDURecord{}
+
+	for _, record := range instances {
+		id := record.UUID
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		policy := SHUTDOWNLEAVE
+		if rt.ShutdownPolicy != nil {
+			policy = rt.ShutdownPolicy(record)
+		}
+		if policy == SHUTDOWNSTOP {
+			err := rt.FOSRuntimePluginInterface.StopFDU(id)
+			if err != nil {
+				rt.PluginLogger().Error(fmt.Sprintf("Unable to stop instance %s %s", id, err.Error()))
+			} else {
+				record.Status = CONFIGURE
+			}
+		}
+		recorded[id] = record
+		rt.removeInstanceEvals(record.FDUID, id)
+	}
+
+	err := rt.State.Update(func(rec *PluginStateRecord) error {
+		rec.Instances = recorded
+		return nil
+	})
+	if err != nil {
+		rt.PluginLogger().Error(fmt.Sprintf("Unable to save plugin state %s", err.Error()))
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return rt.FOSRuntimePluginInterface.StopRuntime()
+}
+
+func (rt *FOSRuntimePluginAbstract) isStopping() bool {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+	return rt.stopping
+}
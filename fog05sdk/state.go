@@ -0,0 +1,257 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrStateConflict is returned when the state is saved with a version different from the stored one
+var ErrStateConflict = &FError{"State version conflict", nil}
+
+// PluginStateRecord is the versioned state of a plugin, Instances is managed by the runtime plugin base,
+// Devices by the DeviceAllocator, Accelerators by the AcceleratorManager and State contains the plugin specific state
+type PluginStateRecord struct {
+	Version      int64                         `json:"version"`
+	Timestamp    int64                         `json:"timestamp"`
+	Instances    map[string]FDURecord          `json:"instances,omitempty"`
+	Devices      map[string][]DeviceAllocation `json:"devices,omitempty"`
+	Accelerators map[string][]string           `json:"accelerators,omitempty"`
+	State        json.RawMessage               `json:"state,omitempty"`
+}
+
+// StateStore stores the versioned state of a plugin in YAKS, and optionally in a local journal
+// used when YAKS is unreachable.
+// The version is checked against the stored one under the mutex of the StateStore, so Save and Update
+// are compare-and-swap only between the users of the same StateStore. YAKS has no conditional writes,
+// the state of a plugin must have a single writer, its own process
+type StateStore struct {
+	connector *YaksConnector
+	node      string
+	plugin    string
+	journal   string
+	// known is the last version loaded or stored, a record older than it means that YAKS is unreachable
+	known int64
+	// empty is true once a missing record has been confirmed with YAKS reachable, the plugin never saved state
+	empty bool
+	mutex sync.Mutex
+}
+
+// NewStateStore returns the state store of the given plugin, if journal is not empty it is the directory
+// of the local journal
+func NewStateStore(connector *YaksConnector, nodeid string, pluginid string, journal string) *StateStore {
+	return &StateStore{connector: connector, node: nodeid, plugin: pluginid, journal: journal}
+}
+
+// Load unmarshals the plugin specific state in state and returns its version, 0 if there is no state
+func (ss *StateStore) Load(state interface{}) (int64, error) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	rec, err := ss.load()
+	if err != nil {
+		return 0, err
+	}
+	if len(rec.State) > 0 {
+		err = json.Unmarshal(rec.State, state)
+		if err != nil {
+			return 0, &FError{"Invalid plugin state", err}
+		}
+	}
+	return rec.Version, nil
+}
+
+// Save stores the plugin specific state if the stored version is equal to version,
+// it returns the new version or ErrStateConflict
+func (ss *StateStore) Save(state interface{}, version int64) (int64, error) {
+	v, err := json.Marshal(state)
+	if err != nil {
+		return 0, err
+	}
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	rec, err := ss.load()
+	if err != nil {
+		return 0, err
+	}
+	if rec.Version != version {
+		return 0, ErrStateConflict
+	}
+	rec.State = v
+	err = ss.store(rec)
+	if err != nil {
+		return 0, err
+	}
+	return rec.Version, nil
+}
+
+// Record returns the whole state record
+func (ss *StateStore) Record() (*PluginStateRecord, error) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	return ss.load()
+}
+
+// Update applies f to the state record and stores it
+func (ss *StateStore) Update(f func(*PluginStateRecord) error) error {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	rec, err := ss.load()
+	if err != nil {
+		return err
+	}
+	err = f(rec)
+	if err != nil {
+		return err
+	}
+	return ss.store(rec)
+}
+
+// AddInstance records the given instance in the state
+func (ss *StateStore) AddInstance(record FDURecord) error {
+	return ss.Update(func(rec *PluginStateRecord) error {
+		rec.Instances[record.UUID] = record
+		return nil
+	})
+}
+
+// RemoveInstance removes the given instance from the state
+func (ss *StateStore) RemoveInstance(instanceid string) error {
+	return ss.Update(func(rec *PluginStateRecord) error {
+		delete(rec.Instances, instanceid)
+		return nil
+	})
+}
+
+// Remove removes the state from YAKS and from the journal
+func (ss *StateStore) Remove() error {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	if ss.journal != "" {
+		os.Remove(ss.journalFile())
+	}
+	ss.known = 0
+	err := ss.connector.Local.Actual.RemoveNodePluginStateRecord(ss.node, ss.plugin)
+	ss.empty = err == nil
+	return err
+}
+
+// load returns the most recent record between YAKS and the journal,
+// a journal more recent than YAKS is written back to YAKS.
+// A get from an unreachable YAKS returns nothing, so a missing record is an empty state
+// only if no version was seen before and YAKS is reachable, otherwise it is an error
+func (ss *StateStore) load() (*PluginStateRecord, error) {
+	rec, err := ss.connector.Local.Actual.GetNodePluginStateRecord(ss.node, ss.plugin)
+	missing := err != nil
+	if missing {
+		rec = &PluginStateRecord{}
+	}
+	if ss.journal != "" {
+		jrec, jerr := ss.readJournal()
+		if jerr == nil && jrec.Version > rec.Version {
+			rec = jrec
+			werr := ss.connector.Local.Actual.AddNodePluginStateRecord(ss.node, ss.plugin, *rec)
+			if werr != nil {
+				ss.connector.Logger().WithField("plugin", ss.plugin).Warn("Unable to restore state from journal: " + werr.Error())
+			}
+		}
+	}
+	if rec.Version < ss.known {
+		return nil, &FError{fmt.Sprintf("Plugin state version %d not found, YAKS unreachable", ss.known), nil}
+	}
+	if missing && rec.Version == 0 && !ss.empty {
+		if !ss.connector.Local.Actual.CheckNodePluginStateStore(ss.node, ss.plugin) {
+			return nil, &FError{"Plugin state not found, YAKS unreachable", nil}
+		}
+		ss.empty = true
+	}
+	ss.known = rec.Version
+	if rec.Instances == nil {
+		rec.Instances = map[string]FDURecord{}
+	}
+	return rec, nil
+}
+
+// store writes the record with an incremented version, the record is written to the journal
+// also when YAKS is unreachable
+func (ss *StateStore) store(rec *PluginStateRecord) error {
+	rec.Version++
+	rec.Timestamp = time.Now().Unix()
+	err := ss.connector.Local.Actual.AddNodePluginStateRecord(ss.node, ss.plugin, *rec)
+	if ss.journal != "" {
+		jerr := ss.writeJournal(rec)
+		if err != nil && jerr == nil {
+			ss.connector.Logger().WithField("plugin", ss.plugin).Warn("Unable to store state in YAKS, saved in journal: " + err.Error())
+			err = nil
+		}
+		if jerr != nil {
+			ss.connector.Logger().WithField("plugin", ss.plugin).Error("Unable to write state journal: " + jerr.Error())
+		}
+	}
+	if err == nil {
+		ss.known = rec.Version
+	}
+	return err
+}
+
+func (ss *StateStore) journalFile() string {
+	return filepath.Join(ss.journal, ss.plugin+".state.json")
+}
+
+func (ss *StateStore) readJournal() (*PluginStateRecord, error) {
+	data, err := ioutil.ReadFile(ss.journalFile())
+	if err != nil {
+		return nil, err
+	}
+	rec := PluginStateRecord{}
+	err = json.Unmarshal(data, &rec)
+	if err != nil {
+		return nil, &FError{"Invalid state journal", err}
+	}
+	return &rec, nil
+}
+
+// writeJournal writes the journal atomically by renaming a temporary file
+func (ss *StateStore) writeJournal(rec *PluginStateRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(ss.journal, 0700)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(ss.journal, ss.plugin+".state.*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	cerr := tmp.Close()
+	if err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), ss.journalFile())
+}
@@ -0,0 +1,373 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// StorageSizeUnit is the unit of the size of FDUStorageDescriptor and FDUStorageRecord, sizes are in GB
+const StorageSizeUnit int64 = 1024 * 1024 * 1024
+
+// StorageDriver provisions the volumes of a storage type
+type StorageDriver interface {
+
+	//Type returns the storage type handled by the driver: BLOCK, FILE or OBJECT
+	Type() string
+
+	//Create creates the volume with the given ID and size in bytes
+	Create(id string, size int64, fs *string) error
+
+	//Attach makes the volume available to the instance and returns the path to be used by the runtime
+	Attach(id string, instanceid string) (string, error)
+
+	//Detach makes the volume no longer available to the instance
+	Detach(id string, instanceid string) error
+
+	//Delete deletes the volume and its content
+	Delete(id string) error
+}
+
+// StorageVolume is a volume provisioned by a StorageManager
+type StorageVolume struct {
+	Record     FDUStorageRecord `json:"record"`
+	InstanceID string           `json:"instance_id"`
+	Size       int64            `json:"size"`
+	Path       *string          `json:"path,omitempty"`
+}
+
+// StorageManager provisions the storage of the instances through the registered drivers
+// and enforces a quota on the provisioned size
+type StorageManager struct {
+	// Quota is the maximum size in bytes of all the volumes, 0 means unlimited
+	Quota int64
+	// InstanceQuota is the maximum size in bytes of the volumes of an instance, 0 means unlimited
+	InstanceQuota int64
+	drivers       map[string]StorageDriver
+	index         string
+	mutex         sync.Mutex
+	volumes       map[string]*StorageVolume
+}
+
+// NewStorageManager returns a storage manager without drivers, if index is not empty the volumes
+// are saved in the index file and restored from it
+func NewStorageManager(index string) (*StorageManager, error) {
+	sm := &StorageManager{drivers: map[string]StorageDriver{}, index: index, volumes: map[string]*StorageVolume{}}
+	if index == "" {
+		return sm, nil
+	}
+	data, err := ioutil.ReadFile(index)
+	if os.IsNotExist(err) {
+		return sm, nil
+	}
+	if err != nil {
+		return nil, &FError{"Unable to read storage index", err}
+	}
+	err = json.Unmarshal(data, &sm.volumes)
+	if err != nil {
+		return nil, &FError{"Invalid storage index", err}
+	}
+	return sm, nil
+}
+
+// NewLocalStorageManager returns a storage manager with the local BLOCK, FILE and OBJECT drivers storing the volumes in root
+func NewLocalStorageManager(root string) (*StorageManager, error) {
+	err := os.MkdirAll(root, 0755)
+	if err != nil {
+		return nil, err
+	}
+	sm, err := NewStorageManager(filepath.Join(root, "volumes.json"))
+	if err != nil {
+		return nil, err
+	}
+	sm.RegisterDriver(&localBlockDriver{dir: filepath.Join(root, "block")})
+	sm.RegisterDriver(&localFileDriver{kind: FILE, dir: filepath.Join(root, "file")})
+	sm.RegisterDriver(&localFileDriver{kind: OBJECT, dir: filepath.Join(root, "object")})
+	return sm, nil
+}
+
+// RegisterDriver registers the driver for its storage type, replacing the previous one
+func (sm *StorageManager) RegisterDriver(driver StorageDriver) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	sm.drivers[driver.Type()] = driver
+}
+
+// StorageRecordsFromDescriptors returns the storage records of the given descriptors
+func StorageRecordsFromDescriptors(descriptors []FDUStorageDescriptor) []FDUStorageRecord {
+	res := []FDUStorageRecord{}
+	for _, d := range descriptors {
+		res = append(res, FDUStorageRecord{StorageID: d.ID, StorageType: d.StorageType, Size: d.Size, FileSystemProtocol: d.FileSystemProtocol, CPID: d.CPID})
+	}
+	return res
+}
+
+// Provision creates the volumes of the storage records of the instance, the records without UUID
+// get one, if a volume cannot be created the ones already created are deleted
+func (sm *StorageManager) Provision(record *FDURecord) error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	// the volumes already provisioned are already counted in the used size
+	var total, required int64
+	for _, s := range record.Storage {
+		size := int64(s.Size) * StorageSizeUnit
+		total += size
+		if _, found := sm.volumes[s.UUID]; !found || s.UUID == "" {
+			required += size
+		}
+	}
+	if sm.InstanceQuota > 0 && total > sm.InstanceQuota {
+		return &FError{fmt.Sprintf("Storage of instance %s exceeds the instance quota", record.UUID), nil}
+	}
+	if sm.Quota > 0 && sm.used()+required > sm.Quota {
+		return &FError{fmt.Sprintf("Storage of instance %s exceeds the node quota", record.UUID), nil}
+	}
+
+	created := []string{}
+	for i := range record.Storage {
+		s := &record.Storage[i]
+		if s.UUID == "" {
+			s.UUID = uuid.UUID.String(uuid.New())
+		}
+		if _, found := sm.volumes[s.UUID]; found {
+			continue
+		}
+		driver, found := sm.drivers[s.StorageType]
+		var err error
+		if !found {
+			err = &FError{"No driver for storage type " + s.StorageType, nil}
+		} else {
+			err = driver.Create(s.UUID, int64(s.Size)*StorageSizeUnit, s.FileSystemProtocol)
+		}
+		if err != nil {
+			for _, id := range created {
+				sm.drivers[sm.volumes[id].Record.StorageType].Delete(id)
+				delete(sm.volumes, id)
+			}
+			sm.save()
+			return &FError{"Unable to create volume " + s.StorageID, err}
+		}
+		sm.volumes[s.UUID] = &StorageVolume{Record: *s, InstanceID: record.UUID, Size: int64(s.Size) * StorageSizeUnit}
+		created = append(created, s.UUID)
+	}
+	return sm.save()
+}
+
+// Attach attaches the volumes of the instance and returns their paths indexed by storage ID
+func (sm *StorageManager) Attach(instanceid string) (map[string]string, error) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	res := map[string]string{}
+	for _, v := range sm.instanceVolumes(instanceid) {
+		path, err := sm.drivers[v.Record.StorageType].Attach(v.Record.UUID, instanceid)
+		if err != nil {
+			sm.save()
+			return nil, &FError{"Unable to attach volume " + v.Record.StorageID, err}
+		}
+		v.Path = &path
+		res[v.Record.StorageID] = path
+	}
+	return res, sm.save()
+}
+
+// Detach detaches the volumes of the instance
+func (sm *StorageManager) Detach(instanceid string) error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	var lastErr error
+	for _, v := range sm.instanceVolumes(instanceid) {
+		if v.Path == nil {
+			continue
+		}
+		err := sm.drivers[v.Record.StorageType].Detach(v.Record.UUID, instanceid)
+		if err != nil {
+			lastErr = &FError{"Unable to detach volume " + v.Record.StorageID, err}
+			continue
+		}
+		v.Path = nil
+	}
+	err := sm.save()
+	if lastErr != nil {
+		return lastErr
+	}
+	return err
+}
+
+// Release detaches and deletes the volumes of the instance
+func (sm *StorageManager) Release(instanceid string) error {
+	err := sm.Detach(instanceid)
+	if err != nil {
+		return err
+	}
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	var lastErr error
+	for _, v := range sm.instanceVolumes(instanceid) {
+		err := sm.drivers[v.Record.StorageType].Delete(v.Record.UUID)
+		if err != nil {
+			lastErr = &FError{"Unable to delete volume " + v.Record.StorageID, err}
+			continue
+		}
+		delete(sm.volumes, v.Record.UUID)
+	}
+	err = sm.save()
+	if lastErr != nil {
+		return lastErr
+	}
+	return err
+}
+
+// Volumes returns the volumes of the instance
+func (sm *StorageManager) Volumes(instanceid string) []StorageVolume {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	res := []StorageVolume{}
+	for _, v := range sm.instanceVolumes(instanceid) {
+		res = append(res, *v)
+	}
+	return res
+}
+
+// Used returns the size in bytes of all the provisioned volumes
+func (sm *StorageManager) Used() int64 {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	return sm.used()
+}
+
+func (sm *StorageManager) used() int64 {
+	var total int64
+	for _, v := range sm.volumes {
+		total += v.Size
+	}
+	return total
+}
+
+func (sm *StorageManager) instanceVolumes(instanceid string) []*StorageVolume {
+	res := []*StorageVolume{}
+	for _, v := range sm.volumes {
+		if v.InstanceID == instanceid {
+			res = append(res, v)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Record.StorageID < res[j].Record.StorageID })
+	return res
+}
+
+func (sm *StorageManager) save() error {
+	if sm.index == "" {
+		return nil
+	}
+	data, err := json.Marshal(sm.volumes)
+	if err != nil {
+		return err
+	}
+	tmp := sm.index + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return &FError{"Unable to write storage index", err}
+	}
+	return os.Rename(tmp, sm.index)
+}
+
+// localBlockDriver stores BLOCK volumes as sparse raw image files
+type localBlockDriver struct {
+	dir string
+}
+
+func (d *localBlockDriver) Type() string {
+	return BLOCK
+}
+
+func (d *localBlockDriver) Create(id string, size int64, fs *string) error {
+	err := os.MkdirAll(d.dir, 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(d.path(id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	err = f.Truncate(size)
+	cerr := f.Close()
+	if err != nil {
+		os.Remove(d.path(id))
+		return err
+	}
+	return cerr
+}
+
+func (d *localBlockDriver) Attach(id string, instanceid string) (string, error) {
+	_, err := os.Stat(d.path(id))
+	if err != nil {
+		return "", err
+	}
+	return d.path(id), nil
+}
+
+func (d *localBlockDriver) Detach(id string, instanceid string) error {
+	return nil
+}
+
+func (d *localBlockDriver) Delete(id string) error {
+	err := os.Remove(d.path(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (d *localBlockDriver) path(id string) string {
+	return filepath.Join(d.dir, id+".img")
+}
+
+// localFileDriver stores FILE volumes, and OBJECT volumes used as local object stores, as directories
+type localFileDriver struct {
+	kind string
+	dir  string
+}
+
+func (d *localFileDriver) Type() string {
+	return d.kind
+}
+
+func (d *localFileDriver) Create(id string, size int64, fs *string) error {
+	return os.MkdirAll(filepath.Join(d.dir, id), 0755)
+}
+
+func (d *localFileDriver) Attach(id string, instanceid string) (string, error) {
+	path := filepath.Join(d.dir, id)
+	_, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func (d *localFileDriver) Detach(id string, instanceid string) error {
+	return nil
+}
+
+func (d *localFileDriver) Delete(id string) error {
+	return os.RemoveAll(filepath.Join(d.dir, id))
+}
@@ -0,0 +1,317 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atolab/yaks-go"
+)
+
+// TelemetryContentType is the content type of the OpenMetrics text format
+const TelemetryContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+const (
+	counterKind   = "counter"
+	gaugeKind     = "gauge"
+	histogramKind = "histogram"
+)
+
+// telemetryBuckets are the upper bounds in seconds of the latency histograms
+var telemetryBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10}
+
+// telemetrySeries is a series of a family, for histograms count and sum are the ones of the observations
+type telemetrySeries struct {
+	labels  []string
+	value   float64
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+// telemetryFamily is a metric with its series indexed by label values
+type telemetryFamily struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+	mutex  sync.Mutex
+	series map[string]*telemetrySeries
+}
+
+// TelemetryRegistry contains the metrics of the SDK and of the plugins
+type TelemetryRegistry struct {
+	mutex    sync.Mutex
+	families []*telemetryFamily
+}
+
+// DefaultTelemetry is the registry of the SDK instrumentation
+var DefaultTelemetry = &TelemetryRegistry{}
+
+// SDK instrumentation
+var (
+	telemetryEvals         = DefaultTelemetry.family("fog05_evals", "Evals handled by function and outcome.", counterKind, "function", "outcome")
+	telemetryEvalDuration  = DefaultTelemetry.family("fog05_eval_duration_seconds", "Duration of the evals handled by function.", histogramKind, "function")
+	telemetryOperations    = DefaultTelemetry.family("fog05_store_operations", "YAKS operations by operation and outcome.", counterKind, "operation", "outcome")
+	telemetrySubscriptions = DefaultTelemetry.family("fog05_subscription_events", "Changes received by the subscription callbacks by kind.", counterKind, "kind")
+	telemetryReconnections = DefaultTelemetry.family("fog05_reconnections", "Failovers to another YAKS router by outcome.", counterKind, "outcome")
+	telemetryTransitions   = DefaultTelemetry.family("fog05_runtime_transitions", "Instance state transitions handled by the runtime plugins by plugin and state.", counterKind, "plugin", "state")
+	telemetryInstances     = DefaultTelemetry.family("fog05_runtime_instances", "Instances managed by the runtime plugins by plugin.", gaugeKind, "plugin")
+)
+
+func (tr *TelemetryRegistry) family(name string, help string, kind string, labels ...string) *telemetryFamily {
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	f := &telemetryFamily{name: name, help: help, kind: kind, labels: labels, series: map[string]*telemetrySeries{}}
+	tr.families = append(tr.families, f)
+	return f
+}
+
+// Counter registers a counter, the _total suffix is added to the name by the exposition
+func (tr *TelemetryRegistry) Counter(name string, help string, labels ...string) *TelemetryCounter {
+	return &TelemetryCounter{tr.family(name, help, counterKind, labels...)}
+}
+
+// Gauge registers a gauge
+func (tr *TelemetryRegistry) Gauge(name string, help string, labels ...string) *TelemetryGauge {
+	return &TelemetryGauge{tr.family(name, help, gaugeKind, labels...)}
+}
+
+// Histogram registers a histogram of durations in seconds
+func (tr *TelemetryRegistry) Histogram(name string, help string, labels ...string) *TelemetryHistogram {
+	return &TelemetryHistogram{tr.family(name, help, histogramKind, labels...)}
+}
+
+// TelemetryCounter is a counter of a registry
+type TelemetryCounter struct {
+	f *telemetryFamily
+}
+
+// Inc increments the counter with the given label values
+func (c *TelemetryCounter) Inc(labels ...string) {
+	c.f.add(1, labels)
+}
+
+// Add adds a non negative value to the counter with the given label values
+func (c *TelemetryCounter) Add(v float64, labels ...string) {
+	if v >= 0 {
+		c.f.add(v, labels)
+	}
+}
+
+// TelemetryGauge is a gauge of a registry
+type TelemetryGauge struct {
+	f *telemetryFamily
+}
+
+// Set sets the gauge with the given label values
+func (g *TelemetryGauge) Set(v float64, labels ...string) {
+	g.f.set(v, labels)
+}
+
+// TelemetryHistogram is a histogram of a registry
+type TelemetryHistogram struct {
+	f *telemetryFamily
+}
+
+// Observe records a duration in the histogram with the given label values
+func (h *TelemetryHistogram) Observe(d time.Duration, labels ...string) {
+	h.f.observe(d.Seconds(), labels)
+}
+
+func (f *telemetryFamily) get(labels []string) *telemetrySeries {
+	key := strings.Join(labels, "\x00")
+	s, found := f.series[key]
+	if !found {
+		s = &telemetrySeries{labels: append([]string{}, labels...)}
+		if f.kind == histogramKind {
+			s.buckets = make([]uint64, len(telemetryBuckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (f *telemetryFamily) add(v float64, labels []string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.get(labels).value += v
+}
+
+func (f *telemetryFamily) set(v float64, labels []string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.get(labels).value = v
+}
+
+func (f *telemetryFamily) observe(v float64, labels []string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	s := f.get(labels)
+	for i, le := range telemetryBuckets {
+		if v <= le {
+			s.buckets[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+// WriteTo writes the metrics of the registry in the OpenMetrics text format
+func (tr *TelemetryRegistry) WriteTo(w io.Writer) (int64, error) {
+	tr.mutex.Lock()
+	families := append([]*telemetryFamily{}, tr.families...)
+	tr.mutex.Unlock()
+
+	var buf bytes.Buffer
+	for _, f := range families {
+		f.write(&buf)
+	}
+	buf.WriteString("# EOF\n")
+	return buf.WriteTo(w)
+}
+
+func (f *telemetryFamily) write(buf *bytes.Buffer) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	fmt.Fprintf(buf, "# TYPE %s %s\n# HELP %s %s\n", f.name, f.kind, f.name, f.help)
+	keys := []string{}
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := f.series[k]
+		switch f.kind {
+		case counterKind:
+			fmt.Fprintf(buf, "%s_total%s %s\n", f.name, f.labelSet(s.labels, "", ""), formatTelemetryValue(s.value))
+		case gaugeKind:
+			fmt.Fprintf(buf, "%s%s %s\n", f.name, f.labelSet(s.labels, "", ""), formatTelemetryValue(s.value))
+		case histogramKind:
+			for i, le := range telemetryBuckets {
+				fmt.Fprintf(buf, "%s_bucket%s %d\n", f.name, f.labelSet(s.labels, "le", formatTelemetryValue(le)), s.buckets[i])
+			}
+			fmt.Fprintf(buf, "%s_bucket%s %d\n", f.name, f.labelSet(s.labels, "le", "+Inf"), s.count)
+			fmt.Fprintf(buf, "%s_count%s %d\n", f.name, f.labelSet(s.labels, "", ""), s.count)
+			fmt.Fprintf(buf, "%s_sum%s %s\n", f.name, f.labelSet(s.labels, "", ""), formatTelemetryValue(s.sum))
+		}
+	}
+}
+
+// labelSet formats the label values of a series, with an additional label if name is not empty
+func (f *telemetryFamily) labelSet(values []string, name string, value string) string {
+	pairs := []string{}
+	for i, l := range f.labels {
+		v := ""
+		if i < len(values) {
+			v = values[i]
+		}
+		pairs = append(pairs, l+"="+strconv.Quote(v))
+	}
+	if name != "" {
+		pairs = append(pairs, name+"="+strconv.Quote(value))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatTelemetryValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// ServeHTTP serves the metrics of the registry
+func (tr *TelemetryRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", TelemetryContentType)
+	tr.WriteTo(w)
+}
+
+// ServeTelemetry serves the metrics of the registry on /metrics of the given address until the server is closed
+func (tr *TelemetryRegistry) ServeTelemetry(address string) (*http.Server, error) {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, &FError{"Unable to listen on " + address, err}
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", tr)
+	srv := &http.Server{Handler: mux}
+	go func() {
+		err := srv.Serve(l)
+		if err != nil && err != http.ErrServerClosed {
+			logger.WithField("address", address).Error("Telemetry endpoint failed: " + err.Error())
+		}
+	}()
+	return srv, nil
+}
+
+// instrumentEval wraps an eval to record its duration and outcome, the function is the last segment of the path
+func instrumentEval(path *yaks.Path, eval yaks.Eval) yaks.Eval {
+	p := path.ToString()
+	function := p[strings.LastIndex(p, "/")+1:]
+	return func(path *yaks.Path, props yaks.Properties) yaks.Value {
+		start := time.Now()
+		v := eval(path, props)
+		telemetryEvalDuration.observe(time.Since(start).Seconds(), []string{function})
+		outcome := "ok"
+		res := EvalResult{}
+		if v == nil {
+			outcome = "error"
+		} else if err := json.Unmarshal([]byte(v.ToString()), &res); err == nil && res.Error != nil {
+			outcome = "error"
+		}
+		telemetryEvals.add(1, []string{function, outcome})
+		return v
+	}
+}
+
+// instrumentListener wraps a subscription listener to count the changes it receives
+func instrumentListener(listener yaks.Listener) yaks.Listener {
+	return func(changes []yaks.Change) {
+		for _, c := range changes {
+			telemetrySubscriptions.add(1, []string{changeKind(c.Kind())})
+		}
+		listener(changes)
+	}
+}
+
+func changeKind(kind yaks.ChangeKind) string {
+	switch kind {
+	case yaks.PUT:
+		return "put"
+	case yaks.UPDATE:
+		return "update"
+	case yaks.REMOVE:
+		return "remove"
+	default:
+		return "unknown"
+	}
+}
+
+func operationOutcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
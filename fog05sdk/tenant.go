@@ -0,0 +1,689 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TenantUndefineTimeout is how long DeleteTenant waits for the agents to undefine the instances of the tenant
+const TenantUndefineTimeout = 2 * time.Minute
+
+// quotaMutex serializes the quota checks with the writes they guard, so that two handles of the process
+// cannot both pass a check for the last unit of a quota. YAKS has no transactions, handles in different
+// processes can still exceed a quota by the writes done at the same time
+var quotaMutex sync.Mutex
+
+// TenantUsage represents the resources used by a tenant, the computational resources
+// are the minimum requirements of the FDUs of the instances
+type TenantUsage struct {
+	FDUs      int     `json:"fdus"`
+	Instances int     `json:"instances"`
+	CPUs      int     `json:"cpus"`
+	RAMMB     float64 `json:"ram_mb"`
+	StorageGB float64 `json:"storage_gb"`
+}
+
+// validateID checks that an ID is a single path segment, so that it cannot address
+// the paths of another tenant
+func validateID(kind string, id string) error {
+	if id == "" || strings.ContainsAny(id, "/*?#[]") || id == "." || id == ".." {
+		return &FError{fmt.Sprintf("Invalid %s ID: %q", kind, id), nil}
+	}
+	return nil
+}
+
+// CreateTenant creates a tenant in the system, it fails if the tenant already exists
+func (yc *YaksConnector) CreateTenant(sysid string, info TenantInfo, conf TenantConfiguration) error {
+	err := validateID("tenant", info.UUID)
+	if err != nil {
+		return err
+	}
+	if _, err := yc.Global.Actual.GetTenantInfo(sysid, info.UUID); err == nil {
+		return &FError{"Tenant " + info.UUID + " already exists", nil}
+	}
+	err = yc.Global.Actual.AddTenantConfiguration(sysid, info.UUID, conf)
+	if err != nil {
+		return err
+	}
+	return yc.Global.Actual.AddTenantInfo(sysid, info.UUID, info)
+}
+
+// ConfigureTenant replaces the configuration of a tenant
+func (yc *YaksConnector) ConfigureTenant(sysid string, tenantid string, conf TenantConfiguration) error {
+	if _, err := yc.Global.Actual.GetTenantInfo(sysid, tenantid); err != nil {
+		return err
+	}
+	return yc.Global.Actual.AddTenantConfiguration(sysid, tenantid, conf)
+}
+
+// DeleteTenant undefines the instances of a tenant and removes the tenant with its catalog and records
+// from the global actual and desired stores, the default tenant cannot be removed.
+// The tenant is removed only once the agents have removed the records of its instances, if some are still there
+// after TenantUndefineTimeout the tenant is kept and the error lists them
+func (yc *YaksConnector) DeleteTenant(sysid string, tenantid string) error {
+	if tenantid == DefaultTenantID {
+		return &FError{"The default tenant cannot be removed", nil}
+	}
+	err := validateID("tenant", tenantid)
+	if err != nil {
+		return err
+	}
+	if _, err := yc.Global.Actual.GetTenantInfo(sysid, tenantid); err != nil {
+		return err
+	}
+	err = yc.undefineTenantInstances(sysid, tenantid)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(TenantUndefineTimeout)
+	for {
+		instances := yc.tenantInstances(sysid, tenantid)
+		if len(instances) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			return &FError{"Tenant " + tenantid + " has instances still running: " + strings.Join(instances, ", "), nil}
+		}
+		time.Sleep(time.Second)
+	}
+	err = yc.Global.Desired.RemoveTenant(sysid, tenantid)
+	if err != nil {
+		return err
+	}
+	return yc.Global.Actual.RemoveTenant(sysid, tenantid)
+}
+
+// undefineTenantInstances asks the agents to undefine the instances of the tenant
+// by writing their records with the UNDEFINE status in the global desired store
+func (yc *YaksConnector) undefineTenantInstances(sysid string, tenantid string) error {
+	s := yc.Global.Actual.GetNodeFDUSelector(sysid, tenantid, "*")
+	for _, kv := range yc.Global.Actual.ws.Get(s) {
+		record := FDURecord{}
+		err := json.Unmarshal([]byte(kv.Value().ToString()), &record)
+		if err != nil {
+			return err
+		}
+		tokens := strings.Split(kv.Path().ToString(), URISeparator)
+		record.Status = UNDEFINE
+		err = yc.Global.Desired.AddNodeFDU(sysid, tenantid, tokens[6], tokens[8], tokens[10], record)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tenantInstances returns the IDs of the instances of the tenant in the global actual store, sorted
+func (yc *YaksConnector) tenantInstances(sysid string, tenantid string) []string {
+	s := yc.Global.Actual.GetNodeFDUSelector(sysid, tenantid, "*")
+	res := []string{}
+	for _, kv := range yc.Global.Actual.ws.Get(s) {
+		tokens := strings.Split(kv.Path().ToString(), URISeparator)
+		res = append(res, tokens[10])
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Tenant returns a handle bound to the tenant of the system, the tenant must exist
+func (yc *YaksConnector) Tenant(sysid string, tenantid string) (*TenantHandle, error) {
+	err := validateID("system", sysid)
+	if err != nil {
+		return nil, err
+	}
+	err = validateID("tenant", tenantid)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := yc.Global.Actual.GetTenantInfo(sysid, tenantid); err != nil {
+		return nil, &FError{"Tenant " + tenantid + " not found", err}
+	}
+	return &TenantHandle{gad: &yc.Global.Actual, sysid: sysid, tenantid: tenantid}, nil
+}
+
+// TenantHandle gives access to the catalog, records, nodes, networks, images and flavors of a tenant,
+// system and tenant are bound at creation so that a handle cannot reach the paths of another tenant
+type TenantHandle struct {
+	gad       *GAD
+	sysid     string
+	tenantid  string
+	authorize func(string) error
+}
+
+// authorized checks the permission with the authorizer of the handle, if any
+func (th *TenantHandle) authorized(permission string) error {
+	if th.authorize == nil {
+		return nil
+	}
+	return th.authorize(permission)
+}
+
+// SysID returns the system of the handle
+func (th *TenantHandle) SysID() string {
+	return th.sysid
+}
+
+// TenantID returns the tenant of the handle
+func (th *TenantHandle) TenantID() string {
+	return th.tenantid
+}
+
+// Info returns the information of the tenant
+func (th *TenantHandle) Info() (*TenantInfo, error) {
+	if err := th.authorized(PERMREAD); err != nil {
+		return nil, err
+	}
+	return th.gad.GetTenantInfo(th.sysid, th.tenantid)
+}
+
+// Configuration returns the configuration of the tenant
+func (th *TenantHandle) Configuration() (*TenantConfiguration, error) {
+	if err := th.authorized(PERMREAD); err != nil {
+		return nil, err
+	}
+	return th.gad.GetTenantConfiguration(th.sysid, th.tenantid)
+}
+
+// Usage returns the resources used by the tenant
+func (th *TenantHandle) Usage() (*TenantUsage, error) {
+	if err := th.authorized(PERMREAD); err != nil {
+		return nil, err
+	}
+	return th.usage()
+}
+
+func (th *TenantHandle) usage() (*TenantUsage, error) {
+	fdus, err := th.gad.GetCatalogAllFDUs(th.sysid, th.tenantid)
+	if err != nil {
+		return nil, err
+	}
+	usage := &TenantUsage{FDUs: len(fdus)}
+	descriptors := map[string]*FDU{}
+	for _, kv := range th.gad.ws.Get(th.gad.GetNodeFDUInstancesSelector(th.sysid, th.tenantid, "*", "*")) {
+		rec := FDURecord{}
+		err := json.Unmarshal([]byte(kv.Value().ToString()), &rec)
+		if err != nil {
+			return nil, err
+		}
+		usage.Instances++
+		desc, found := descriptors[rec.FDUID]
+		if !found {
+			desc, _ = th.gad.GetCatalogFDUInfo(th.sysid, th.tenantid, rec.FDUID)
+			descriptors[rec.FDUID] = desc
+		}
+		if desc != nil {
+			usage.add(desc.ComputationRequirements)
+		}
+	}
+	return usage, nil
+}
+
+func (u *TenantUsage) add(req FDUComputationalRequirements) {
+	u.CPUs += req.CPUMinCount
+	u.RAMMB += req.RAMSizeMB
+	u.StorageGB += req.StorageSizeGB
+}
+
+// quota returns the quota of the tenant, nil if the tenant has none
+func (th *TenantHandle) quota() *TenantQuota {
+	conf, err := th.gad.GetTenantConfiguration(th.sysid, th.tenantid)
+	if err != nil {
+		return nil
+	}
+	return conf.Quota
+}
+
+// checkFDUQuota checks that a new FDU can be added to the catalog, it is called holding quotaMutex
+func (th *TenantHandle) checkFDUQuota(fduid string) error {
+	q := th.quota()
+	if q == nil || q.MaxFDUs == 0 {
+		return nil
+	}
+	if fduid != "" {
+		if _, err := th.gad.GetCatalogFDUInfo(th.sysid, th.tenantid, fduid); err == nil {
+			return nil
+		}
+	}
+	fdus, err := th.gad.GetCatalogAllFDUs(th.sysid, th.tenantid)
+	if err != nil {
+		return err
+	}
+	if len(fdus) >= q.MaxFDUs {
+		return &FError{fmt.Sprintf("Tenant %s quota exceeded: %d FDUs", th.tenantid, q.MaxFDUs), nil}
+	}
+	return nil
+}
+
+// checkInstanceQuota checks that a new instance of the FDU can be defined, it is called holding quotaMutex
+func (th *TenantHandle) checkInstanceQuota(fduid string) error {
+	q := th.quota()
+	if q == nil {
+		return nil
+	}
+	desc, err := th.gad.GetCatalogFDUInfo(th.sysid, th.tenantid, fduid)
+	if err != nil {
+		return err
+	}
+	usage, err := th.usage()
+	if err != nil {
+		return err
+	}
+	usage.Instances++
+	usage.add(desc.ComputationRequirements)
+	switch {
+	case q.MaxInstances > 0 && usage.Instances > q.MaxInstances:
+		return &FError{fmt.Sprintf("Tenant %s quota exceeded: %d instances", th.tenantid, q.MaxInstances), nil}
+	case q.MaxCPUs > 0 && usage.CPUs > q.MaxCPUs:
+		return &FError{fmt.Sprintf("Tenant %s quota exceeded: %d CPUs", th.tenantid, q.MaxCPUs), nil}
+	case q.MaxRAMMB > 0 && usage.RAMMB > q.MaxRAMMB:
+		return &FError{fmt.Sprintf("Tenant %s quota exceeded: %v MB of RAM", th.tenantid, q.MaxRAMMB), nil}
+	case q.MaxStorageGB > 0 && usage.StorageGB > q.MaxStorageGB:
+		return &FError{fmt.Sprintf("Tenant %s quota exceeded: %v GB of storage", th.tenantid, q.MaxStorageGB), nil}
+	}
+	return nil
+}
+
+// Nodes
+
+// GetAllNodes ...
+func (th *TenantHandle) GetAllNodes() ([]string, error) {
+	if err := th.authorized(PERMREAD); err != nil {
+		return nil, err
+	}
+	return th.gad.GetAllNodes(th.sysid, th.tenantid)
+}
+
+// GetNodeInfo ...
+func (th *TenantHandle) GetNodeInfo(nodeid string) (*NodeInfo, error) {
+	if err := th.authorized(PERMREAD); err != nil {
+		return nil, err
+	}
+	if err := validateID("node", nodeid); err != nil {
+		return nil, err
+	}
+	return th.gad.GetNodeInfo(th.sysid, th.tenantid, nodeid)
+}
+
+// GetNodeStatus ...
+func (th *TenantHandle) GetNodeStatus(nodeid string) (*NodeStatus, error) {
+	if err := th.authorized(PERMREAD); err != nil {
+		return nil, err
+	}
+	if err := validateID("node", nodeid); err != nil {
+		return nil, err
+	}
+	return th.gad.GetNodeStatus(th.sysid, th.tenantid, nodeid)
+}
+
+// Catalog
+
+// GetCatalogAllFDUs ...
+func (th *TenantHandle) GetCatalogAllFDUs() ([]string, error) {
+	if err := th.authorized(PERMREAD); err != nil {
+		return nil, err
+	}
+	return th.gad.GetCatalogAllFDUs(th.sysid, th.tenantid)
+}
+
+// GetCatalogFDUInfo ...
+func (th *TenantHandle) GetCatalogFDUInfo(fduid string) (*FDU, error) {
+	if err := th.authorized(PERMREAD); err != nil {
+		return nil, err
+	}
+	if err := validateID("FDU", fduid); err != nil {
+		return nil, err
+	}
+	return th.gad.GetCatalogFDUInfo(th.sysid, th.tenantid, fduid)
+}
+
+// AddCatalogFDUInfo adds the FDU to the catalog, checking the FDU quota of the tenant
+func (th *TenantHandle) AddCatalogFDUInfo(fduid string, info FDU) error {
+	if err := th.authorized(PERMMANAGE); err != nil {
+		return err
+	}
+	if err := validateID("FDU", fduid); err != nil {
+		return err
+	}
+	quotaMutex.Lock()
+	defer quotaMutex.Unlock()
+	if err := th.checkFDUQuota(fduid); err != nil {
+		return err
+	}
+	return th.gad.AddCatalogFDUInfo(th.sysid, th.tenantid, fduid, info)
+}
+
+// RemoveCatalogFDUInfo ...
+func (th *TenantHandle) RemoveCatalogFDUInfo(fduid string) error {
+	if err := th.authorized(PERMMANAGE); err != nil {
+		return err
+	}
+	if err := validateID("FDU", fduid); err != nil {
+		return err
+	}
+	return th.gad.RemoveCatalogFDUInfo(th.sysid, th.tenantid, fduid)
+}
+
+// OnboardFDUFromNode onboards the FDU through the node, checking the FDU quota of the tenant
+func (th *TenantHandle) OnboardFDUFromNode(nodeid string, info FDU) (*EvalResult, error) {
+	if err := th.authorized(PERMMANAGE); err != nil {
+		return nil, err
+	}
+	if err := validateID("node", nodeid); err != nil {
+		return nil, err
+	}
+	fduid := ""
+	if info.UUID != nil {
+		fduid = *info.UUID
+	}
+	quotaMutex.Lock()
+	defer quotaMutex.Unlock()
+	if err := th.checkFDUQuota(fduid); err != nil {
+		return nil, err
+	}
+	return th.gad.OnboardFDUFromNode(th.sysid, th.tenantid, nodeid, info)
+}
+
+// Records
+
+// GetNodeFDUs ...
+func (th *TenantHandle) GetNodeFDUs(nodeid string) ([]string, error) {
+	if err := th.authorized(PERMREAD); err != nil {
+		return nil, err
+	}
+	if err := validateID("node", nodeid); err != nil {
+		return nil, err
+	}
+	return th.gad.GetNodeFDUs(th.sysid, th.tenantid, nodeid)
+}
+
+// GetFDUNodes ...
+func (th *TenantHandle) GetFDUNodes(fduid string) ([]string, error) {
+	if err := th.authorized(PERMREAD); err != nil {
+		return nil, err
+	}
+	if err := validateID("FDU", fduid); err != nil {
+		return nil, err
+	}
+	return th.gad.GetFDUNodes(th.sysid, th.tenantid, fduid)
+}
+
+// GetNodeFDUInstances ...
+func (th *TenantHandle) GetNodeFDUInstances(nodeid string, fduid string) ([]Couple, error) {
+	if err := th.authorized(PERMREAD); err != nil {
+		return nil, err
+	}
+	if err := validateID("node", nodeid); err != nil {
+		return nil, err
+	}
+	if err := validateID("FDU", fduid); err != nil {
+		return nil, err
+	}
+	return th.gad.GetNodeFDUInstances(th.sysid, th.tenantid, nodeid, fduid)
+}
+
+// GetNodeFDUInstance ...
+func (th *TenantHandle) GetNodeFDUInstance(nodeid string, instanceid string) (*FDURecord, error) {
+	if err := th.authorized(PERMREAD); err != nil {
+		return nil, err
+	}
+	if err := validateID("node", nodeid); err != nil {
+		return nil, err
+	}
+	if err := validateID("instance", instanceid); err != nil {
+		return nil, err
+	}
+	return th.gad.GetNodeFDUInstance(th.sysid, th.tenantid, nodeid, instanceid)
+}
+
+// GetFDUInstanceNode ...
+func (th *TenantHandle) GetFDUInstanceNode(instanceid string) (string, error) {
+	if err := th.authorized(PERMREAD); err != nil {
+		return "", err
+	}
+	if err := validateID("instance", instanceid); err != nil {
+		return "", err
+	}
+	return th.gad.GetFDUInstanceNode(th.sysid, th.tenantid, instanceid)
+}
+
+// DefineFDUInNode defines an instance of the FDU in the node, checking the instance and resource quotas of the tenant
+func (th *TenantHandle) DefineFDUInNode(nodeid string, fduid string) (*EvalResult, error) {
+	if err := th.authorized(PERMOPERATE); err != nil {
+		return nil, err
+	}
+	if err := validateID("node", nodeid); err != nil {
+		return nil, err
+	}
+	if err := validateID("FDU", fduid); err != nil {
+		return nil, err
+	}
+	quotaMutex.Lock()
+	defer quotaMutex.Unlock()
+	if err := th.checkInstanceQuota(fduid); err != nil {
+		return nil, err
+	}
+	return th.gad.DefineFDUInNode(th.sysid, th.tenantid, nodeid, fduid)
+}
+
+// StartFDUInNode ...
+func (th *TenantHandle) StartFDUInNode(instanceid string, env string) (*EvalResult, error) {
+	if err := th.authorized(PERMOPERATE); err != nil {
+		return nil, err
+	}
+	if err := validateID("instance", instanceid); err != nil {
+		return nil, err
+	}
+	return th.gad.StartFDUInNode(th.sysid, th.tenantid, instanceid, env)
+}
+
+// RunFDUInNode ...
+func (th *TenantHandle) RunFDUInNode(instanceid string, env string) (*EvalResult, error) {
+	if err := th.authorized(PERMOPERATE); err != nil {
+		return nil, err
+	}
+	if err := validateID("instance", instanceid); err != nil {
+		return nil, err
+	}
+	return th.gad.RunFDUInNode(th.sysid, th.tenantid, instanceid, env)
+}
+
+// LogFDUInNode ...
+func (th *TenantHandle) LogFDUInNode(instanceid string) (*EvalResult, error) {
+	if err := th.authorized(PERMOPERATE); err != nil {
+		return nil, err
+	}
+	if err := validateID("instance", instanceid); err != nil {
+		return nil, err
+	}
+	return th.gad.LogFDUInNode(th.sysid, th.tenantid, instanceid)
+}
+
+// LsFDUInNode ...
+func (th *TenantHandle) LsFDUInNode(instanceid string) (*EvalResult, error) {
+	if err := th.authorized(PERMOPERATE); err != nil {
+		return nil, err
+	}
+	if err := validateID("instance", instanceid); err != nil {
+		return nil, err
+	}
+	return th.gad.LsFDUInNode(th.sysid, th.tenantid, instanceid)
+}
+
+// GetFileFDUInNode ...
+func (th *TenantHandle) GetFileFDUInNode(instanceid string, filename string) (*EvalResult, error) {
+	if err := th.authorized(PERMOPERATE); err != nil {
+		return nil, err
+	}
+	if err := validateID("instance", instanceid); err != nil {
+		return nil, err
+	}
+	return th.gad.GetFileFDUInNode(th.sysid, th.tenantid, instanceid, filename)
+}
+
+// GetFDUInstanceMetrics ...
+func (th *TenantHandle) GetFDUInstanceMetrics(instanceid string) ([]FDUMetrics, error) {
+	if err := th.authorized(PERMREAD); err != nil {
+		return nil, err
+	}
+	if err := validateID("instance", instanceid); err != nil {
+		return nil, err
+	}
+	return th.gad.GetFDUInstanceMetrics(th.sysid, th.tenantid, instanceid)
+}
+
+// GetFDUMetricsAggregate ...
+func (th *TenantHandle) GetFDUMetricsAggregate(fduid string) (*MetricsAggregate, error) {
+	if err := th.authorized(PERMREAD); err != nil {
+		return nil, err
+	}
+	if err := validateID("FDU", fduid); err != nil {
+		return nil, err
+	}
+	return th.gad.GetFDUMetricsAggregate(th.sysid, th.tenantid, fduid)
+}
+
+// Networks
+
+// GetAllNetwork ...
+func (th *TenantHandle) GetAllNetwork() ([]string, error) {
+	if err := th.authorized(PERMREAD); err != nil {
+		return nil, err
+	}
+	return th.gad.GetAllNetwork(th.sysid, th.tenantid)
+}
+
+// GetNetwork ...
+func (th *TenantHandle) GetNetwork(netid string) (*VirtualNetwork, error) {
+	if err := th.authorized(PERMREAD); err != nil {
+		return nil, err
+	}
+	if err := validateID("network", netid); err != nil {
+		return nil, err
+	}
+	return th.gad.GetNetwork(th.sysid, th.tenantid, netid)
+}
+
+// AddNetwork ...
+func (th *TenantHandle) AddNetwork(netid string, info VirtualNetwork) error {
+	if err := th.authorized(PERMMANAGE); err != nil {
+		return err
+	}
+	if err := validateID("network", netid); err != nil {
+		return err
+	}
+	return th.gad.AddNetwork(th.sysid, th.tenantid, netid, info)
+}
+
+// RemoveNetwork ...
+func (th *TenantHandle) RemoveNetwork(netid string) error {
+	if err := th.authorized(PERMMANAGE); err != nil {
+		return err
+	}
+	if err := validateID("network", netid); err != nil {
+		return err
+	}
+	return th.gad.RemoveNetwork(th.sysid, th.tenantid, netid)
+}
+
+// Images
+
+// GetAllImages ...
+func (th *TenantHandle) GetAllImages() ([]string, error) {
+	if err := th.authorized(PERMREAD); err != nil {
+		return nil, err
+	}
+	return th.gad.GetAllImages(th.sysid, th.tenantid)
+}
+
+// GetImage ...
+func (th *TenantHandle) GetImage(imageid string) (*FDUImage, error) {
+	if err := th.authorized(PERMREAD); err != nil {
+		return nil, err
+	}
+	if err := validateID("image", imageid); err != nil {
+		return nil, err
+	}
+	return th.gad.GetImage(th.sysid, th.tenantid, imageid)
+}
+
+// AddImage ...
+func (th *TenantHandle) AddImage(imageid string, info FDUImage) error {
+	if err := th.authorized(PERMMANAGE); err != nil {
+		return err
+	}
+	if err := validateID("image", imageid); err != nil {
+		return err
+	}
+	return th.gad.AddImage(th.sysid, th.tenantid, imageid, info)
+}
+
+// RemoveImage ...
+func (th *TenantHandle) RemoveImage(imageid string) error {
+	if err := th.authorized(PERMMANAGE); err != nil {
+		return err
+	}
+	if err := validateID("image", imageid); err != nil {
+		return err
+	}
+	return th.gad.RemoveImage(th.sysid, th.tenantid, imageid)
+}
+
+// Flavors
+
+// GetAllFlavors ...
+func (th *TenantHandle) GetAllFlavors() ([]string, error) {
+	if err := th.authorized(PERMREAD); err != nil {
+		return nil, err
+	}
+	return th.gad.GetAllFlavors(th.sysid, th.tenantid)
+}
+
+// GetFlavor ...
+func (th *TenantHandle) GetFlavor(flvid string) (*FDUComputationalRequirements, error) {
+	if err := th.authorized(PERMREAD); err != nil {
+		return nil, err
+	}
+	if err := validateID("flavor", flvid); err != nil {
+		return nil, err
+	}
+	return th.gad.GetFlavor(th.sysid, th.tenantid, flvid)
+}
+
+// AddFlavor ...
+func (th *TenantHandle) AddFlavor(flvid string, info FDUComputationalRequirements) error {
+	if err := th.authorized(PERMMANAGE); err != nil {
+		return err
+	}
+	if err := validateID("flavor", flvid); err != nil {
+		return err
+	}
+	return th.gad.AddFlavor(th.sysid, th.tenantid, flvid, info)
+}
+
+// RemoveFlavor ...
+func (th *TenantHandle) RemoveFlavor(flvid string) error {
+	if err := th.authorized(PERMMANAGE); err != nil {
+		return err
+	}
+	if err := validateID("flavor", flvid); err != nil {
+		return err
+	}
+	return th.gad.RemoveFlavor(th.sysid, th.tenantid, flvid)
+}
@@ -0,0 +1,348 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atolab/yaks-go"
+)
+
+// TraceContextKey is the eval property carrying the trace context, in the W3C traceparent format
+const TraceContextKey string = "traceparent"
+
+const (
+	// SPANCLIENT is the kind of the spans of the eval calls
+	SPANCLIENT string = "CLIENT"
+
+	// SPANSERVER is the kind of the spans of the eval handlers
+	SPANSERVER string = "SERVER"
+)
+
+// TraceContext identifies a span inside a trace
+type TraceContext struct {
+	TraceID string
+	SpanID  string
+}
+
+// String returns the trace context in the traceparent format
+func (tc TraceContext) String() string {
+	return fmt.Sprintf("00-%s-%s-01", tc.TraceID, tc.SpanID)
+}
+
+// ParseTraceContext parses a trace context in the traceparent format
+func ParseTraceContext(s string) (*TraceContext, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return nil, &FError{"Invalid trace context: " + s, nil}
+	}
+	for _, p := range parts[1:3] {
+		if _, err := hex.DecodeString(p); err != nil {
+			return nil, &FError{"Invalid trace context: " + s, err}
+		}
+	}
+	return &TraceContext{TraceID: parts[1], SpanID: parts[2]}, nil
+}
+
+// Span is a timed operation of a trace
+type Span struct {
+	Context       TraceContext
+	ParentSpanID  string
+	Name          string
+	Kind          string
+	Start         time.Time
+	End           time.Time
+	Attributes    map[string]string
+	Error         bool
+	StatusMessage string
+	tracer        *Tracer
+}
+
+// SpanExporter exports the ended spans
+type SpanExporter interface {
+	ExportSpans([]Span) error
+	Close() error
+}
+
+// Tracer creates the spans and sends them to its exporter, without exporter no span is created
+type Tracer struct {
+	mutex    sync.RWMutex
+	exporter SpanExporter
+}
+
+// DefaultTracer is the tracer of the eval calls and of the eval handlers of the connectors without their own tracer
+var DefaultTracer = &Tracer{}
+
+// NewTracer returns a tracer sending the spans to exporter
+func NewTracer(exporter SpanExporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// SetExporter sets the exporter of the tracer, nil disables tracing
+func (t *Tracer) SetExporter(exporter SpanExporter) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.exporter = exporter
+}
+
+// Enabled returns true if the tracer has an exporter
+func (t *Tracer) Enabled() bool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.exporter != nil
+}
+
+// StartSpan starts a span, child of parent if it is not nil, it returns nil if tracing is disabled
+func (t *Tracer) StartSpan(name string, kind string, parent *TraceContext) *Span {
+	if !t.Enabled() {
+		return nil
+	}
+	span := &Span{Name: name, Kind: kind, Start: time.Now(), Attributes: map[string]string{}, tracer: t}
+	span.Context.SpanID = randomHex(8)
+	if parent != nil {
+		span.Context.TraceID = parent.TraceID
+		span.ParentSpanID = parent.SpanID
+	} else {
+		span.Context.TraceID = randomHex(16)
+	}
+	return span
+}
+
+// SetError marks the span as failed
+func (s *Span) SetError(msg string) {
+	if s == nil {
+		return
+	}
+	s.Error = true
+	s.StatusMessage = msg
+}
+
+// Finish ends the span and exports it
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.End = time.Now()
+	s.tracer.mutex.RLock()
+	exporter := s.tracer.exporter
+	s.tracer.mutex.RUnlock()
+	if exporter == nil {
+		return
+	}
+	err := exporter.ExportSpans([]Span{*s})
+	if err != nil {
+		logger.WithField("span", s.Name).Error("Unable to export span: " + err.Error())
+	}
+}
+
+// TraceContextFromProperties returns the trace context of the eval properties, or nil
+func TraceContextFromProperties(props yaks.Properties) *TraceContext {
+	v, found := props[TraceContextKey]
+	if !found {
+		return nil
+	}
+	tc, err := ParseTraceContext(v)
+	if err != nil {
+		return nil
+	}
+	return tc
+}
+
+// WithTraceContext returns a copy of the eval parameters with the trace context of the properties
+// of the eval being handled, so that the eval calls done by an eval handler are part of its trace
+func WithTraceContext(params map[string]interface{}, props yaks.Properties) map[string]interface{} {
+	res := map[string]interface{}{}
+	for k, v := range params {
+		res[k] = v
+	}
+	if v, found := props[TraceContextKey]; found {
+		res[TraceContextKey] = v
+	}
+	return res
+}
+
+// startEvalCall starts the client span of an eval call, the parent is the trace context in the parameters if any.
+// It returns a copy of the parameters with the context of the span, to be serialized by Dict2Args
+func startEvalCall(tracer *Tracer, fname string, params map[string]interface{}) (*Span, map[string]interface{}) {
+	var parent *TraceContext
+	if v, found := params[TraceContextKey]; found {
+		parent, _ = ParseTraceContext(fmt.Sprintf("%v", v))
+	}
+	span := tracer.StartSpan(fname, SPANCLIENT, parent)
+	if span == nil {
+		return nil, params
+	}
+	span.Attributes["fog05.function"] = fname
+	res := map[string]interface{}{}
+	for k, v := range params {
+		res[k] = v
+	}
+	res[TraceContextKey] = span.Context.String()
+	return span, res
+}
+
+// finishEvalCall ends the client span of an eval call with the status of the reply
+func finishEvalCall(span *Span, kvs []yaks.Entry) {
+	if span == nil {
+		return
+	}
+	if len(kvs) == 0 {
+		span.SetError("function replied nil")
+	} else {
+		setEvalStatus(span, kvs[0].Value().ToString())
+	}
+	span.Finish()
+}
+
+// traceEval wraps an eval handler in a server span, the handler gets the context of the span in its properties
+func traceEval(tracer *Tracer, fname string, evalcb func(yaks.Properties) interface{}) func(yaks.Properties) interface{} {
+	return func(props yaks.Properties) interface{} {
+		span := tracer.StartSpan(fname, SPANSERVER, TraceContextFromProperties(props))
+		if span == nil {
+			return evalcb(props)
+		}
+		span.Attributes["fog05.function"] = fname
+		inner := yaks.Properties{}
+		for k, v := range props {
+			inner[k] = v
+		}
+		inner[TraceContextKey] = span.Context.String()
+		res := evalcb(inner)
+		if v, err := json.Marshal(res); err == nil {
+			setEvalStatus(span, string(v))
+		}
+		span.Finish()
+		return res
+	}
+}
+
+// setEvalStatus marks the span as failed if the reply is an EvalResult with an error
+func setEvalStatus(span *Span, reply string) {
+	res := EvalResult{}
+	if json.Unmarshal([]byte(reply), &res) != nil || res.Error == nil {
+		return
+	}
+	msg := "error " + strconv.Itoa(*res.Error)
+	if res.ErrorMessage != nil {
+		msg = msg + ": " + *res.ErrorMessage
+	}
+	span.SetError(msg)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// OTLPFileExporter writes the spans in a file, one OTLP/JSON ExportTraceServiceRequest per line
+type OTLPFileExporter struct {
+	service string
+	mutex   sync.Mutex
+	file    *os.File
+}
+
+// NewOTLPFileExporter returns an exporter appending to the given file, service is the service.name of the spans
+func NewOTLPFileExporter(path string, service string) (*OTLPFileExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, &FError{"Unable to open trace file " + path, err}
+	}
+	return &OTLPFileExporter{service: service, file: f}, nil
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes"`
+	Status            otlpStatus      `json:"status"`
+}
+
+// ExportSpans writes the spans as a line of the file
+func (e *OTLPFileExporter) ExportSpans(spans []Span) error {
+	res := []otlpSpan{}
+	for _, s := range spans {
+		o := otlpSpan{
+			TraceID:           s.Context.TraceID,
+			SpanID:            s.Context.SpanID,
+			ParentSpanID:      s.ParentSpanID,
+			Name:              s.Name,
+			Kind:              2, // SPAN_KIND_SERVER
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        []otlpAttribute{},
+			Status:            otlpStatus{Code: 1}, // STATUS_CODE_OK
+		}
+		if s.Kind == SPANCLIENT {
+			o.Kind = 3 // SPAN_KIND_CLIENT
+		}
+		if s.Error {
+			o.Status = otlpStatus{Code: 2, Message: s.StatusMessage} // STATUS_CODE_ERROR
+		}
+		for k, v := range s.Attributes {
+			o.Attributes = append(o.Attributes, otlpAttribute{Key: k, Value: otlpValue{StringValue: v}})
+		}
+		res = append(res, o)
+	}
+	req := map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource":   map[string]interface{}{"attributes": []otlpAttribute{{Key: "service.name", Value: otlpValue{StringValue: e.service}}}},
+				"scopeSpans": []interface{}{map[string]interface{}{"scope": map[string]string{"name": "fog05sdk"}, "spans": res}},
+			},
+		},
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	_, err = e.file.Write(append(data, '\n'))
+	return err
+}
+
+// Close closes the file
+func (e *OTLPFileExporter) Close() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.file.Close()
+}
@@ -0,0 +1,330 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/atolab/yaks-go"
+)
+
+// TransferChunkSize is the maximum size of a chunk of a transfer
+const TransferChunkSize = 64 * 1024
+
+// TransferPollInterval is the interval used by a transfer reader to look for new chunks
+// when no notification is received
+const TransferPollInterval = 500 * time.Millisecond
+
+// TransferWindow is the maximum number of chunks of a transfer stored and not read yet,
+// the writer waits for the reader to remove the oldest one before writing a new one
+const TransferWindow = 16
+
+// TransferWindowTimeout is how long the writer waits for the reader to remove a chunk before failing the transfer
+const TransferWindowTimeout = time.Minute
+
+// TransferInfo is the completion marker of a chunked transfer, it is written once all the chunks are stored
+type TransferInfo struct {
+	ID       string  `json:"id"`
+	Chunks   int     `json:"chunks"`
+	Size     int64   `json:"size"`
+	Checksum string  `json:"checksum"` // SHA256 of the whole content
+	Error    *string `json:"error,omitempty"`
+}
+
+// A transfer is stored under its path as:
+//   <path>/chunks/<seq> the chunks, as raw values, seq starts from 0
+//   <path>/info the TransferInfo, written after the last chunk
+//   <path>/cancel written by the reader to stop a transfer (eg. a followed log)
+
+func transferChunkPath(path string, seq int) *yaks.Path {
+	return CreatePath([]string{path, "chunks", strconv.Itoa(seq)})
+}
+
+func transferInfoPath(path string) *yaks.Path {
+	return CreatePath([]string{path, "info"})
+}
+
+func transferCancelPath(path string) *yaks.Path {
+	return CreatePath([]string{path, "cancel"})
+}
+
+// transferWriter splits what is written in sequence-numbered chunks stored under the transfer path,
+// at most TransferWindow chunks not read yet are stored
+type transferWriter struct {
+	ws     *yaksSession
+	path   string
+	seq    int
+	size   int64
+	hash   hash.Hash
+	notify chan bool
+	done   chan bool
+	once   sync.Once
+	sid    *yaks.SubscriptionID
+}
+
+func newTransferWriter(ws *yaksSession, path string) *transferWriter {
+	return &transferWriter{ws: ws, path: path, hash: sha256.New(), notify: make(chan bool, 1), done: make(chan bool)}
+}
+
+// wait waits for the reader to remove the chunk TransferWindow chunks before the next one,
+// the removals are notified by a subscription made at the first wait
+func (tw *transferWriter) wait() error {
+	if tw.seq < TransferWindow {
+		return nil
+	}
+	if tw.sid == nil {
+		sid, err := tw.ws.Subscribe(CreateSelector([]string{tw.path, "chunks", "*"}), func(changes []yaks.Change) {
+			select {
+			case tw.notify <- true:
+			default:
+			}
+		})
+		if err != nil {
+			return err
+		}
+		tw.sid = sid
+	}
+	s := CreateSelector([]string{tw.path, "chunks", strconv.Itoa(tw.seq - TransferWindow)})
+	deadline := time.After(TransferWindowTimeout)
+	for len(tw.ws.Get(s)) > 0 {
+		select {
+		case <-tw.done:
+			return io.ErrClosedPipe
+		case <-deadline:
+			return &FError{"Transfer reader not reading chunk " + strconv.Itoa(tw.seq-TransferWindow), nil}
+		case <-tw.notify:
+		case <-time.After(TransferPollInterval):
+		}
+	}
+	return nil
+}
+
+// stop makes a pending and the following waits fail, it can be called while writing
+func (tw *transferWriter) stop() {
+	tw.once.Do(func() {
+		close(tw.done)
+	})
+}
+
+// release removes the subscription of the writer once the writes are over
+func (tw *transferWriter) release() {
+	if tw.sid != nil {
+		tw.ws.Unsubscribe(tw.sid)
+		tw.sid = nil
+	}
+}
+
+func (tw *transferWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		end := written + TransferChunkSize
+		if end > len(p) {
+			end = len(p)
+		}
+		err := tw.wait()
+		if err != nil {
+			return written, err
+		}
+		chunk := make([]byte, end-written)
+		copy(chunk, p[written:end])
+		err = tw.ws.Put(transferChunkPath(tw.path, tw.seq), yaks.NewRawValue(chunk))
+		if err != nil {
+			return written, &FError{"Unable to store transfer chunk " + strconv.Itoa(tw.seq), err}
+		}
+		tw.hash.Write(chunk)
+		tw.size += int64(len(chunk))
+		tw.seq++
+		written = end
+	}
+	return written, nil
+}
+
+// finish writes the completion marker, if cause is not nil the transfer is marked as failed
+func (tw *transferWriter) finish(id string, cause error) error {
+	tw.release()
+	info := TransferInfo{ID: id, Chunks: tw.seq, Size: tw.size, Checksum: hex.EncodeToString(tw.hash.Sum(nil))}
+	if cause != nil {
+		msg := cause.Error()
+		info.Error = &msg
+	}
+	v, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return tw.ws.Put(transferInfoPath(tw.path), yaks.NewStringValue(string(v)))
+}
+
+// sendTransfer copies the reader in a chunked transfer stored under path and closes the reader,
+// the transfer stops at EOF or when the reader side cancels it
+func sendTransfer(ws *yaksSession, path string, id string, r io.ReadCloser) error {
+	tw := newTransferWriter(ws, path)
+
+	var cancelled int32
+	var once sync.Once
+	closeReader := func() {
+		once.Do(func() { r.Close() })
+	}
+	sid, err := ws.Subscribe(CreateSelector([]string{path, "cancel"}), func(changes []yaks.Change) {
+		atomic.StoreInt32(&cancelled, 1)
+		tw.stop()
+		closeReader()
+	})
+	if err != nil {
+		closeReader()
+		tw.finish(id, err)
+		return err
+	}
+
+	var cause error
+	buf := make([]byte, TransferChunkSize)
+	for atomic.LoadInt32(&cancelled) == 0 {
+		n, rerr := r.Read(buf)
+		if n > 0 {
+			_, werr := tw.Write(buf[:n])
+			if werr != nil {
+				cause = werr
+				break
+			}
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			if atomic.LoadInt32(&cancelled) == 0 {
+				cause = rerr
+			}
+			break
+		}
+	}
+	closeReader()
+	ws.Unsubscribe(sid)
+	if atomic.LoadInt32(&cancelled) == 1 {
+		// the reader is gone, nobody will consume the chunks left
+		tw.release()
+		for seq := 0; seq < tw.seq; seq++ {
+			ws.Remove(transferChunkPath(path, seq))
+		}
+		return nil
+	}
+	err = tw.finish(id, cause)
+	if err != nil {
+		return err
+	}
+	return cause
+}
+
+// transferReader reassembles a chunked transfer, chunks are removed from YAKS once read
+// and the checksum is verified at the end of the transfer
+type transferReader struct {
+	ws     *yaksSession
+	path   string
+	seq    int
+	buf    []byte
+	hash   hash.Hash
+	size   int64
+	info   *TransferInfo
+	notify chan bool
+	done   chan bool
+	once   sync.Once
+	sid    *yaks.SubscriptionID
+}
+
+func newTransferReader(ws *yaksSession, path string) (*transferReader, error) {
+	tr := &transferReader{ws: ws, path: path, hash: sha256.New(), notify: make(chan bool, 1), done: make(chan bool)}
+	sid, err := ws.Subscribe(CreateSelector([]string{path, "**"}), func(changes []yaks.Change) {
+		select {
+		case tr.notify <- true:
+		default:
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	tr.sid = sid
+	return tr, nil
+}
+
+func (tr *transferReader) Read(p []byte) (int, error) {
+	for len(tr.buf) == 0 {
+		if tr.info != nil && tr.seq >= tr.info.Chunks {
+			return 0, tr.verify()
+		}
+		chunk := tr.ws.Get(CreateSelector([]string{tr.path, "chunks", strconv.Itoa(tr.seq)}))
+		if len(chunk) > 0 {
+			tr.buf = chunk[0].Value().Encode()
+			tr.hash.Write(tr.buf)
+			tr.size += int64(len(tr.buf))
+			tr.ws.Remove(transferChunkPath(tr.path, tr.seq))
+			tr.seq++
+			continue
+		}
+		if tr.info == nil {
+			kvs := tr.ws.Get(CreateSelector([]string{tr.path, "info"}))
+			if len(kvs) > 0 {
+				info := TransferInfo{}
+				err := json.Unmarshal([]byte(kvs[0].Value().ToString()), &info)
+				if err != nil {
+					return 0, &FError{"Invalid transfer info", err}
+				}
+				tr.info = &info
+				continue
+			}
+		}
+		select {
+		case <-tr.done:
+			return 0, io.ErrClosedPipe
+		case <-tr.notify:
+		case <-time.After(TransferPollInterval):
+		}
+	}
+	n := copy(p, tr.buf)
+	tr.buf = tr.buf[n:]
+	return n, nil
+}
+
+func (tr *transferReader) verify() error {
+	if tr.info.Error != nil {
+		return &FError{"Transfer failed: " + *tr.info.Error, nil}
+	}
+	if tr.size != tr.info.Size || hex.EncodeToString(tr.hash.Sum(nil)) != tr.info.Checksum {
+		return &FError{"Transfer checksum mismatch", nil}
+	}
+	return io.EOF
+}
+
+// Close cancels the transfer if it is still running and removes it from YAKS, with the chunks not read
+func (tr *transferReader) Close() error {
+	tr.once.Do(func() {
+		close(tr.done)
+		tr.ws.Unsubscribe(tr.sid)
+		if tr.info == nil {
+			tr.ws.Put(transferCancelPath(tr.path), yaks.NewStringValue(strconv.FormatInt(time.Now().Unix(), 10)))
+		}
+		// the chunks not read yet would stay in YAKS
+		for _, kv := range tr.ws.Get(CreateSelector([]string{tr.path, "chunks", "*"})) {
+			tr.ws.Remove(kv.Path())
+		}
+		tr.ws.Remove(transferInfoPath(tr.path))
+		tr.ws.Remove(transferCancelPath(tr.path))
+	})
+	return nil
+}
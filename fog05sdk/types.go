@@ -43,12 +43,40 @@ type SystemConfig struct {
 	Config string `json:"config"`
 }
 
+// RoleBinding represents a role of a user, Tenant is empty for the system wide admin role
+type RoleBinding struct {
+	Role   string `json:"role"`
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// UserInfo represents user information, the password is stored as a salted hash
+type UserInfo struct {
+	Name         string        `json:"name"`
+	UUID         string        `json:"uuid"`
+	PasswordHash string        `json:"password_hash"`
+	Roles        []RoleBinding `json:"roles"`
+}
+
 // TenantInfo represents tenant information
 type TenantInfo struct {
 	Name string `json:"name"`
 	UUID string `json:"uuid"`
 }
 
+// TenantQuota represents the resources a tenant can use, zero means unlimited
+type TenantQuota struct {
+	MaxFDUs      int     `json:"max_fdus"`
+	MaxInstances int     `json:"max_instances"`
+	MaxCPUs      int     `json:"max_cpus"`
+	MaxRAMMB     float64 `json:"max_ram_mb"`
+	MaxStorageGB float64 `json:"max_storage_gb"`
+}
+
+// TenantConfiguration represents tenant configuration
+type TenantConfiguration struct {
+	Quota *TenantQuota `json:"quota,omitempty"`
+}
+
 // CPUSpec represents CPU specification
 type CPUSpec struct {
 	Model     string  `json:"model"`
@@ -87,6 +115,7 @@ type VolatilitySpec struct {
 type AcceleratorSpec struct {
 	HWAddress        string   `json:"hw_address"`
 	Name             string   `json:"name"`
+	Type             string   `json:"type,omitempty"`
 	SupportedLibrary []string `json:"supported_library"`
 	Available        bool     `json:"available"`
 }
@@ -215,6 +244,22 @@ type Plugin struct {
 	Configuration *jsont   `json:"configuration,omitempty"`
 }
 
+// PluginHeartbeat represents the heartbeat periodically published by a plugin
+type PluginHeartbeat struct {
+	PluginID  string `json:"plugin_id"`
+	Status    string `json:"status"`
+	Timestamp int64  `json:"timestamp"`
+	Uptime    int64  `json:"uptime"`
+	Instances int    `json:"instances"`
+}
+
+// PluginLiveness represents the liveness state of a plugin published by the heartbeat watcher of its node
+type PluginLiveness struct {
+	PluginID  string `json:"plugin_id"`
+	State     string `json:"state"`
+	Timestamp int64  `json:"timestamp"`
+}
+
 // InterfaceInfo represents the results of interface managements functions in the network manager plugin
 type InterfaceInfo struct {
 	Name      string `json:"name"`
@@ -238,3 +283,24 @@ type EvalResult struct {
 	Error        *int    `json:"error,omitempty"`
 	ErrorMessage *string `json:"error_msg,omitempty"`
 }
+
+// ExecRequest represents a request to execute a command in, or to attach to, an FDU instance
+type ExecRequest struct {
+	Command []string          `json:"command,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	TTY     bool              `json:"tty"`
+	Rows    int               `json:"rows,omitempty"`
+	Cols    int               `json:"cols,omitempty"`
+}
+
+// ExecTerminalSize represents the size of the terminal of an exec session
+type ExecTerminalSize struct {
+	Rows int `json:"rows"`
+	Cols int `json:"cols"`
+}
+
+// ExecExit represents the exit status of an exec session
+type ExecExit struct {
+	ExitCode int     `json:"exit_code"`
+	Error    *string `json:"error,omitempty"`
+}
@@ -0,0 +1,367 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ROLEADMIN is the role of the system administrators, it allows everything on every tenant
+	ROLEADMIN string = "admin"
+
+	// ROLETENANTADMIN is the role of the administrators of a tenant, it allows to manage
+	// the catalog, networks, images, flavors and users of the tenant
+	ROLETENANTADMIN string = "tenant-admin"
+
+	// ROLEOPERATOR is the role allowing to define and operate the instances of a tenant
+	ROLEOPERATOR string = "operator"
+
+	// ROLEVIEWER is the role allowing to read the information of a tenant
+	ROLEVIEWER string = "viewer"
+)
+
+const (
+	// PERMREAD is the permission to read the information of a tenant
+	PERMREAD string = "read"
+
+	// PERMOPERATE is the permission to define instances and to call their evals
+	PERMOPERATE string = "operate"
+
+	// PERMMANAGE is the permission to change the catalog, networks, images, flavors and users of a tenant
+	PERMMANAGE string = "manage"
+
+	// PERMADMIN is the permission to create, configure and delete tenants
+	PERMADMIN string = "admin"
+)
+
+// rolePermissions are the permissions granted by each role
+var rolePermissions = map[string][]string{
+	ROLEADMIN:       {PERMREAD, PERMOPERATE, PERMMANAGE, PERMADMIN},
+	ROLETENANTADMIN: {PERMREAD, PERMOPERATE, PERMMANAGE},
+	ROLEOPERATOR:    {PERMREAD, PERMOPERATE},
+	ROLEVIEWER:      {PERMREAD},
+}
+
+// passwordIterations is the number of PBKDF2 iterations of the password hashes
+const passwordIterations = 100000
+
+const passwordScheme = "pbkdf2-sha256"
+
+// dummyPasswordHash is checked when logging in as a user that does not exist,
+// so that the response time does not tell whether the user exists
+var dummyPasswordHash = fmt.Sprintf("%s$%d$%s$%s", passwordScheme, passwordIterations, "ZHVtbXlzYWx0ZHVtbXlzYQ", "ZHVtbXloYXNoZHVtbXloYXNoZHVtbXloYXNoZHVtbXk")
+
+// HashPassword returns a salted PBKDF2-SHA256 hash of the password,
+// in the form pbkdf2-sha256$<iterations>$<salt>$<hash>
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", &FError{"Unable to generate salt", err}
+	}
+	key := pbkdf2SHA256([]byte(password), salt, passwordIterations, sha256.Size)
+	return fmt.Sprintf("%s$%d$%s$%s", passwordScheme, passwordIterations, base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// CheckPassword returns true if the password matches the hash returned by HashPassword,
+// hashes with an iteration count or a length different from the ones of HashPassword are rejected,
+// so that a tampered hash cannot make the check arbitrarily slow
+func CheckPassword(hash string, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != passwordScheme {
+		return false
+	}
+	iter, err := strconv.Atoi(parts[1])
+	if err != nil || iter != passwordIterations {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(expected) != sha256.Size {
+		return false
+	}
+	key := pbkdf2SHA256([]byte(password), salt, iter, len(expected))
+	return subtle.ConstantTimeCompare(key, expected) == 1
+}
+
+// pbkdf2SHA256 derives a key of the given length as specified by RFC 8018
+func pbkdf2SHA256(password []byte, salt []byte, iter int, length int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var res []byte
+	buf := make([]byte, 4)
+	for block := uint32(1); len(res) < length; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf, block)
+		prf.Write(buf)
+		u := prf.Sum(nil)
+		t := append([]byte{}, u...)
+		for i := 1; i < iter; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		res = append(res, t...)
+	}
+	return res[:length]
+}
+
+// Allows returns true if one of the roles of the user grants the permission on the tenant
+func (u *UserInfo) Allows(tenantid string, permission string) bool {
+	for _, rb := range u.Roles {
+		if rb.Role != ROLEADMIN && rb.Tenant != tenantid {
+			continue
+		}
+		for _, p := range rolePermissions[rb.Role] {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func validateRoles(roles []RoleBinding) error {
+	for _, rb := range roles {
+		if _, found := rolePermissions[rb.Role]; !found {
+			return &FError{"Role not recognized: " + rb.Role, nil}
+		}
+		if rb.Role == ROLEADMIN && rb.Tenant != "" {
+			return &FError{"The admin role cannot be bound to a tenant", nil}
+		}
+		if rb.Role != ROLEADMIN {
+			if err := validateID("tenant", rb.Tenant); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CreateUser creates a user in the system with the given password and roles, it fails if the user already exists.
+// No authorization is checked, it is meant to create the first administrator, see AuthorizedClient.CreateUser
+func (yc *YaksConnector) CreateUser(sysid string, userid string, name string, password string, roles []RoleBinding) error {
+	err := validateID("user", userid)
+	if err != nil {
+		return err
+	}
+	err = validateRoles(roles)
+	if err != nil {
+		return err
+	}
+	if _, err := yc.Global.Actual.GetUserInfo(sysid, userid); err == nil {
+		return &FError{"User " + userid + " already exists", nil}
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return yc.Global.Actual.AddUserInfo(sysid, userid, UserInfo{Name: name, UUID: userid, PasswordHash: hash, Roles: roles})
+}
+
+// Login checks the credentials of the user against the users of the system
+// and returns a client authorized with the roles of the user
+func (yc *YaksConnector) Login(sysid string, userid string, password string) (*AuthorizedClient, error) {
+	if err := validateID("user", userid); err != nil {
+		return nil, err
+	}
+	user, err := yc.Global.Actual.GetUserInfo(sysid, userid)
+	if err != nil {
+		CheckPassword(dummyPasswordHash, password)
+		return nil, &FError{"Invalid user or password", nil}
+	}
+	if !CheckPassword(user.PasswordHash, password) {
+		return nil, &FError{"Invalid user or password", nil}
+	}
+	return &AuthorizedClient{connector: yc, sysid: sysid, user: *user}, nil
+}
+
+// AuthorizedClient gives access to the tenants and users of a system on behalf of a logged in user,
+// the operations not allowed by the roles of the user are rejected.
+// The checks are done by the client only: the users, with their PasswordHash, are in the global actual store,
+// which any YAKS client can read and write, so they are not a protection against a client that bypasses the SDK
+type AuthorizedClient struct {
+	connector *YaksConnector
+	sysid     string
+	user      UserInfo
+}
+
+// User returns the user of the client
+func (ac *AuthorizedClient) User() UserInfo {
+	return ac.user
+}
+
+func (ac *AuthorizedClient) check(tenantid string, permission string) error {
+	if !ac.user.Allows(tenantid, permission) {
+		return &FError{fmt.Sprintf("User %s is not allowed to %s tenant %s", ac.user.UUID, permission, tenantid), nil}
+	}
+	return nil
+}
+
+// Tenant returns a handle on the tenant whose operations are checked against the roles of the user
+func (ac *AuthorizedClient) Tenant(tenantid string) (*TenantHandle, error) {
+	if err := ac.check(tenantid, PERMREAD); err != nil {
+		return nil, err
+	}
+	th, err := ac.connector.Tenant(ac.sysid, tenantid)
+	if err != nil {
+		return nil, err
+	}
+	th.authorize = func(permission string) error {
+		return ac.check(tenantid, permission)
+	}
+	return th, nil
+}
+
+// GetAllTenantsIDs returns the tenants on which the user has a role, all of them for administrators
+func (ac *AuthorizedClient) GetAllTenantsIDs() ([]string, error) {
+	ids, err := ac.connector.Global.Actual.GetAllTenantsIDs(ac.sysid)
+	if err != nil {
+		return nil, err
+	}
+	res := []string{}
+	for _, id := range ids {
+		if ac.user.Allows(id, PERMREAD) {
+			res = append(res, id)
+		}
+	}
+	return res, nil
+}
+
+// CreateTenant creates a tenant, only administrators are allowed
+func (ac *AuthorizedClient) CreateTenant(info TenantInfo, conf TenantConfiguration) error {
+	if err := ac.check(info.UUID, PERMADMIN); err != nil {
+		return err
+	}
+	return ac.connector.CreateTenant(ac.sysid, info, conf)
+}
+
+// ConfigureTenant replaces the configuration of a tenant, only administrators are allowed
+func (ac *AuthorizedClient) ConfigureTenant(tenantid string, conf TenantConfiguration) error {
+	if err := ac.check(tenantid, PERMADMIN); err != nil {
+		return err
+	}
+	return ac.connector.ConfigureTenant(ac.sysid, tenantid, conf)
+}
+
+// DeleteTenant removes a tenant with its catalog and records, only administrators are allowed
+func (ac *AuthorizedClient) DeleteTenant(tenantid string) error {
+	if err := ac.check(tenantid, PERMADMIN); err != nil {
+		return err
+	}
+	return ac.connector.DeleteTenant(ac.sysid, tenantid)
+}
+
+// checkRoles checks that the user can grant or revoke the roles, tenant administrators
+// can only manage the roles bound to their tenants. Managing users, even without roles,
+// requires to be an administrator of at least one tenant
+func (ac *AuthorizedClient) checkRoles(roles []RoleBinding) error {
+	if !ac.managesUsers() {
+		return &FError{fmt.Sprintf("User %s is not allowed to manage users", ac.user.UUID), nil}
+	}
+	for _, rb := range roles {
+		perm := PERMMANAGE
+		if rb.Role == ROLEADMIN {
+			perm = PERMADMIN
+		}
+		if err := ac.check(rb.Tenant, perm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// managesUsers returns true if the user has the manage permission on at least one tenant
+func (ac *AuthorizedClient) managesUsers() bool {
+	for _, rb := range ac.user.Roles {
+		if ac.user.Allows(rb.Tenant, PERMMANAGE) {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateUser creates a user with the given roles, the user must be allowed to grant all of them
+func (ac *AuthorizedClient) CreateUser(userid string, name string, password string, roles []RoleBinding) error {
+	if err := ac.checkRoles(roles); err != nil {
+		return err
+	}
+	return ac.connector.CreateUser(ac.sysid, userid, name, password, roles)
+}
+
+// SetUserRoles replaces the roles of a user, the user must be allowed to revoke the current roles
+// and to grant the new ones
+func (ac *AuthorizedClient) SetUserRoles(userid string, roles []RoleBinding) error {
+	if err := validateID("user", userid); err != nil {
+		return err
+	}
+	if err := validateRoles(roles); err != nil {
+		return err
+	}
+	user, err := ac.connector.Global.Actual.GetUserInfo(ac.sysid, userid)
+	if err != nil {
+		return err
+	}
+	if err := ac.checkRoles(append(append([]RoleBinding{}, user.Roles...), roles...)); err != nil {
+		return err
+	}
+	user.Roles = roles
+	return ac.connector.Global.Actual.AddUserInfo(ac.sysid, userid, *user)
+}
+
+// RemoveUser removes a user, the user must be allowed to revoke all of its roles
+func (ac *AuthorizedClient) RemoveUser(userid string) error {
+	if err := validateID("user", userid); err != nil {
+		return err
+	}
+	user, err := ac.connector.Global.Actual.GetUserInfo(ac.sysid, userid)
+	if err != nil {
+		return err
+	}
+	if err := ac.checkRoles(user.Roles); err != nil {
+		return err
+	}
+	return ac.connector.Global.Actual.RemoveUserInfo(ac.sysid, userid)
+}
+
+// ChangePassword changes the password of the logged in user
+func (ac *AuthorizedClient) ChangePassword(oldpassword string, newpassword string) error {
+	user, err := ac.connector.Global.Actual.GetUserInfo(ac.sysid, ac.user.UUID)
+	if err != nil {
+		return err
+	}
+	if !CheckPassword(user.PasswordHash, oldpassword) {
+		return &FError{"Invalid user or password", nil}
+	}
+	user.PasswordHash, err = HashPassword(newpassword)
+	if err != nil {
+		return err
+	}
+	return ac.connector.Global.Actual.AddUserInfo(ac.sysid, ac.user.UUID, *user)
+}
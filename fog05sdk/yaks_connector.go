@@ -16,15 +16,18 @@ package fog05sdk
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/atolab/yaks-go"
+	"github.com/google/uuid"
 
 	log "github.com/sirupsen/logrus"
 )
 
-var logger = log.WithFields(log.Fields{"pkg": "fog05"})
+var logger log.FieldLogger = log.WithFields(log.Fields{"pkg": "fog05"})
 
 // GlobalActualPrefix constant for Actual Global store
 const GlobalActualPrefix string = "/agfos"
@@ -101,7 +104,7 @@ func Dict2Args(d map[string]interface{}) string {
 
 // GAD is Global Actual Desired
 type GAD struct {
-	ws        *yaks.Workspace
+	ws        *yaksSession
 	prefix    string
 	listeners []*yaks.SubscriptionID
 	evals     []*yaks.Path
@@ -163,7 +166,7 @@ func (gad *GAD) GetSysConfigurationPath(sysid string) *yaks.Path {
 
 // GetAllUsersSelector ...
 func (gad *GAD) GetAllUsersSelector(sysid string) *yaks.Selector {
-	return CreateSelector([]string{gad.prefix, sysid, "users", "*"})
+	return CreateSelector([]string{gad.prefix, sysid, "users", "*", "info"})
 }
 
 // GetUserInfoPath ...
@@ -175,7 +178,12 @@ func (gad *GAD) GetUserInfoPath(sysid string, userid string) *yaks.Path {
 
 // GetAllTenantsSelector ...
 func (gad *GAD) GetAllTenantsSelector(sysid string) *yaks.Selector {
-	return CreateSelector([]string{gad.prefix, sysid, "tenants", "*"})
+	return CreateSelector([]string{gad.prefix, sysid, "tenants", "*", "info"})
+}
+
+// GetTenantSelector ...
+func (gad *GAD) GetTenantSelector(sysid string, tenantid string) *yaks.Selector {
+	return CreateSelector([]string{gad.prefix, sysid, "tenants", tenantid, "**"})
 }
 
 // GetTenantInfoPath ...
@@ -316,6 +324,31 @@ func (gad *GAD) GetFDUInstanceSelector(sysid string, tenantid string, instanceid
 	return CreateSelector([]string{gad.prefix, sysid, "tenants", tenantid, "nodes", "*", "fdu", "*", "instances", instanceid, "info"})
 }
 
+// GetNodeFDUInstanceMetricsPath ...
+func (gad *GAD) GetNodeFDUInstanceMetricsPath(sysid string, tenantid string, nodeid string, fduid string, instanceid string, slot int) *yaks.Path {
+	return CreatePath([]string{gad.prefix, sysid, "tenants", tenantid, "nodes", nodeid, "fdu", fduid, "instances", instanceid, "metrics", strconv.Itoa(slot)})
+}
+
+// GetNodeFDUInstanceMetricsSelector ...
+func (gad *GAD) GetNodeFDUInstanceMetricsSelector(sysid string, tenantid string, nodeid string, fduid string, instanceid string) *yaks.Selector {
+	return CreateSelector([]string{gad.prefix, sysid, "tenants", tenantid, "nodes", nodeid, "fdu", fduid, "instances", instanceid, "metrics", "*"})
+}
+
+// GetFDUInstanceMetricsSelector ...
+func (gad *GAD) GetFDUInstanceMetricsSelector(sysid string, tenantid string, instanceid string) *yaks.Selector {
+	return CreateSelector([]string{gad.prefix, sysid, "tenants", tenantid, "nodes", "*", "fdu", "*", "instances", instanceid, "metrics", "*"})
+}
+
+// GetNodeMetricsSelector ...
+func (gad *GAD) GetNodeMetricsSelector(sysid string, tenantid string, nodeid string) *yaks.Selector {
+	return CreateSelector([]string{gad.prefix, sysid, "tenants", tenantid, "nodes", nodeid, "fdu", "*", "instances", "*", "metrics", "*"})
+}
+
+// GetFDUMetricsSelector ...
+func (gad *GAD) GetFDUMetricsSelector(sysid string, tenantid string, fduid string) *yaks.Selector {
+	return CreateSelector([]string{gad.prefix, sysid, "tenants", tenantid, "nodes", "*", "fdu", fduid, "instances", "*", "metrics", "*"})
+}
+
 // GetFDUStartEvalSelector ...
 func (gad *GAD) GetFDUStartEvalSelector(sysid string, tenantid string, instanceid string, env string) *yaks.Selector {
 	e := fmt.Sprintf("?(env=%s)", env)
@@ -510,6 +543,15 @@ func (gad *GAD) GetAgentExecSelectorWithParams(sysid string, tenantid string, no
 	return CreateSelector([]string{gad.prefix, sysid, "tenants", tenantid, "nodes", nodeid, "agent", "exec", f})
 }
 
+// execAgent calls an agent eval with the given parameters in a client span
+func (gad *GAD) execAgent(sysid string, tenantid string, nodeid string, fname string, params map[string]interface{}) []yaks.Entry {
+	span, params := startEvalCall(gad.ws.tracing(), fname, params)
+	s, _ := yaks.NewSelector(gad.GetAgentExecSelectorWithParams(sysid, tenantid, nodeid, fname, params).ToString())
+	kvs := gad.ws.Get(s)
+	finishEvalCall(span, kvs)
+	return kvs
+}
+
 // ID Extraction
 
 // ExtractUserIDFromPath ...
@@ -574,7 +616,7 @@ func (gad *GAD) ExtractImageIDFromPath(path *yaks.Path) string {
 
 // ExtractFlavorIDFromPath ...
 func (gad *GAD) ExtractFlavorIDFromPath(path *yaks.Path) string {
-	return strings.Split(path.ToString(), URISeparator)[5]
+	return strings.Split(path.ToString(), URISeparator)[6]
 }
 
 // ExtractNodeFDUIDFromPath ...
@@ -666,6 +708,41 @@ func (gad *GAD) GetAllUserIDs(sysid string) ([]string, error) {
 	return ids, nil
 }
 
+// GetUserInfo ...
+func (gad *GAD) GetUserInfo(sysid string, userid string) (*UserInfo, error) {
+	s, _ := yaks.NewSelector(gad.GetUserInfoPath(sysid, userid).ToString())
+	kvs := gad.ws.Get(s)
+	if len(kvs) == 0 {
+		return nil, &FError{"User Not Found", nil}
+	}
+	v := kvs[0].Value().ToString()
+	sv := UserInfo{}
+	err := json.Unmarshal([]byte(v), &sv)
+	if err != nil {
+		return nil, err
+	}
+	return &sv, nil
+}
+
+// AddUserInfo ...
+func (gad *GAD) AddUserInfo(sysid string, userid string, info UserInfo) error {
+	s := gad.GetUserInfoPath(sysid, userid)
+	v, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	sv := yaks.NewStringValue(string(v))
+	err = gad.ws.Put(s, sv)
+	return err
+}
+
+// RemoveUserInfo ...
+func (gad *GAD) RemoveUserInfo(sysid string, userid string) error {
+	s := gad.GetUserInfoPath(sysid, userid)
+	err := gad.ws.Remove(s)
+	return err
+}
+
 // Tenant
 
 // GetAllTenantsIDs ...
@@ -683,6 +760,79 @@ func (gad *GAD) GetAllTenantsIDs(sysid string) ([]string, error) {
 	return ids, nil
 }
 
+// GetTenantInfo ...
+func (gad *GAD) GetTenantInfo(sysid string, tenantid string) (*TenantInfo, error) {
+	s, _ := yaks.NewSelector(gad.GetTenantInfoPath(sysid, tenantid).ToString())
+	kvs := gad.ws.Get(s)
+	if len(kvs) == 0 {
+		return nil, &FError{"Tenant Not Found", nil}
+	}
+	v := kvs[0].Value().ToString()
+	sv := TenantInfo{}
+	err := json.Unmarshal([]byte(v), &sv)
+	if err != nil {
+		return nil, err
+	}
+	return &sv, nil
+}
+
+// AddTenantInfo ...
+func (gad *GAD) AddTenantInfo(sysid string, tenantid string, info TenantInfo) error {
+	s := gad.GetTenantInfoPath(sysid, tenantid)
+	v, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	sv := yaks.NewStringValue(string(v))
+	err = gad.ws.Put(s, sv)
+	return err
+}
+
+// GetTenantConfiguration ...
+func (gad *GAD) GetTenantConfiguration(sysid string, tenantid string) (*TenantConfiguration, error) {
+	s, _ := yaks.NewSelector(gad.GetTenantConfigurationPath(sysid, tenantid).ToString())
+	kvs := gad.ws.Get(s)
+	if len(kvs) == 0 {
+		return nil, &FError{"Tenant Configuration Not Found", nil}
+	}
+	v := kvs[0].Value().ToString()
+	sv := TenantConfiguration{}
+	err := json.Unmarshal([]byte(v), &sv)
+	if err != nil {
+		return nil, err
+	}
+	return &sv, nil
+}
+
+// AddTenantConfiguration ...
+func (gad *GAD) AddTenantConfiguration(sysid string, tenantid string, conf TenantConfiguration) error {
+	s := gad.GetTenantConfigurationPath(sysid, tenantid)
+	v, err := json.Marshal(conf)
+	if err != nil {
+		return err
+	}
+	sv := yaks.NewStringValue(string(v))
+	err = gad.ws.Put(s, sv)
+	return err
+}
+
+// RemoveTenant removes the tenant with its catalog, records, nodes, networks, images and flavors,
+// the tenant information is removed last so that an interrupted removal can be retried
+func (gad *GAD) RemoveTenant(sysid string, tenantid string) error {
+	s := gad.GetTenantSelector(sysid, tenantid)
+	info := gad.GetTenantInfoPath(sysid, tenantid)
+	for _, kv := range gad.ws.Get(s) {
+		if kv.Path().ToString() == info.ToString() {
+			continue
+		}
+		err := gad.ws.Remove(kv.Path())
+		if err != nil {
+			return err
+		}
+	}
+	return gad.ws.Remove(info)
+}
+
 // GetAllNodes ...
 func (gad *GAD) GetAllNodes(sysid string, tenantid string) ([]string, error) {
 	s := gad.GetAllNodesSelector(sysid, tenantid)
@@ -966,6 +1116,77 @@ func (gad *GAD) GetNodeFDUInstance(sysid string, tenantid string, nodeid string,
 	return &sv, nil
 }
 
+// AddNodeFDUInstanceMetrics stores a metrics sample of the instance in the given slot of its history
+func (gad *GAD) AddNodeFDUInstanceMetrics(sysid string, tenantid string, nodeid string, fduid string, instanceid string, slot int, info FDUMetrics) error {
+	s := gad.GetNodeFDUInstanceMetricsPath(sysid, tenantid, nodeid, fduid, instanceid, slot)
+	v, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	sv := yaks.NewStringValue(string(v))
+	err = gad.ws.Put(s, sv)
+	return err
+}
+
+// RemoveNodeFDUInstanceMetrics removes the metrics history of the instance
+func (gad *GAD) RemoveNodeFDUInstanceMetrics(sysid string, tenantid string, nodeid string, fduid string, instanceid string) error {
+	s := gad.GetNodeFDUInstanceMetricsSelector(sysid, tenantid, nodeid, fduid, instanceid)
+	for _, kv := range gad.ws.Get(s) {
+		err := gad.ws.Remove(kv.Path())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetNodeFDUInstanceScope returns the system and the tenant of an instance in the node,
+// looking for the record of the instance in every system and tenant
+func (gad *GAD) GetNodeFDUInstanceScope(nodeid string, fduid string, instanceid string) (string, string, error) {
+	s := CreateSelector([]string{gad.prefix, "*", "tenants", "*", "nodes", nodeid, "fdu", fduid, "instances", instanceid, "info"})
+	kvs := gad.ws.Get(s)
+	if len(kvs) == 0 {
+		return "", "", &FError{"FDU Instance Not Found", nil}
+	}
+	tokens := strings.Split(kvs[0].Path().ToString(), URISeparator)
+	return tokens[2], tokens[4], nil
+}
+
+// GetFDUInstanceMetrics returns the metrics samples of the instance sorted by timestamp
+func (gad *GAD) GetFDUInstanceMetrics(sysid string, tenantid string, instanceid string) ([]FDUMetrics, error) {
+	return getMetrics(gad.ws, gad.GetFDUInstanceMetricsSelector(sysid, tenantid, instanceid))
+}
+
+// GetNodeMetrics returns the metrics samples of all the instances in the node sorted by timestamp
+func (gad *GAD) GetNodeMetrics(sysid string, tenantid string, nodeid string) ([]FDUMetrics, error) {
+	return getMetrics(gad.ws, gad.GetNodeMetricsSelector(sysid, tenantid, nodeid))
+}
+
+// GetFDUMetrics returns the metrics samples of all the instances of the FDU sorted by timestamp
+func (gad *GAD) GetFDUMetrics(sysid string, tenantid string, fduid string) ([]FDUMetrics, error) {
+	return getMetrics(gad.ws, gad.GetFDUMetricsSelector(sysid, tenantid, fduid))
+}
+
+// GetNodeMetricsAggregate returns the aggregate of the metrics of all the instances in the node
+func (gad *GAD) GetNodeMetricsAggregate(sysid string, tenantid string, nodeid string) (*MetricsAggregate, error) {
+	samples, err := gad.GetNodeMetrics(sysid, tenantid, nodeid)
+	if err != nil {
+		return nil, err
+	}
+	agg := AggregateMetrics(samples)
+	return &agg, nil
+}
+
+// GetFDUMetricsAggregate returns the aggregate of the metrics of all the instances of the FDU
+func (gad *GAD) GetFDUMetricsAggregate(sysid string, tenantid string, fduid string) (*MetricsAggregate, error) {
+	samples, err := gad.GetFDUMetrics(sysid, tenantid, fduid)
+	if err != nil {
+		return nil, err
+	}
+	agg := AggregateMetrics(samples)
+	return &agg, nil
+}
+
 // GetFDUInstanceNode ...
 func (gad *GAD) GetFDUInstanceNode(sysid string, tenantid string, instanceid string) (string, error) {
 	s := gad.GetFDUInstanceSelector(sysid, tenantid, instanceid)
@@ -1711,9 +1932,7 @@ func (gad *GAD) AddNodePortToNetwork(sysid string, tenantid string, nodeid strin
 	params["cp_uuid"] = portid
 	params["network_uuid"] = netid
 
-	s, _ := yaks.NewSelector(gad.GetAgentExecSelectorWithParams(sysid, tenantid, nodeid, fname, params).ToString())
-
-	kvs := gad.ws.Get(s)
+	kvs := gad.execAgent(sysid, tenantid, nodeid, fname, params)
 	if len(kvs) == 0 {
 		return nil, &FError{"AddNodePortToNetwork function replied nil", nil}
 	}
@@ -1772,9 +1991,7 @@ func (gad *GAD) RemoveNodePortFromNetwork(sysid string, tenantid string, nodeid
 
 	params["cp_uuid"] = portid
 
-	s, _ := yaks.NewSelector(gad.GetAgentExecSelectorWithParams(sysid, tenantid, nodeid, fname, params).ToString())
-
-	kvs := gad.ws.Get(s)
+	kvs := gad.execAgent(sysid, tenantid, nodeid, fname, params)
 	if len(kvs) == 0 {
 		return nil, &FError{"RemoveNodePortFromNetwork function replied nil", nil}
 	}
@@ -1891,9 +2108,7 @@ func (gad *GAD) RemoveFloatingIPFromNode(sysid string, tenantid string, nodeid s
 
 	params["floating_uuid"] = ipid
 
-	s, _ := yaks.NewSelector(gad.GetAgentExecSelectorWithParams(sysid, tenantid, nodeid, fname, params).ToString())
-
-	kvs := gad.ws.Get(s)
+	kvs := gad.execAgent(sysid, tenantid, nodeid, fname, params)
 	if len(kvs) == 0 {
 		return nil, &FError{"RemoveFloatingIPFromNode function replied nil", nil}
 	}
@@ -1953,9 +2168,7 @@ func (gad *GAD) AssignNodeFloatingIP(sysid string, tenantid string, nodeid strin
 	params["floating_uuid"] = ipid
 	params["cp_uuid"] = cpid
 
-	s, _ := yaks.NewSelector(gad.GetAgentExecSelectorWithParams(sysid, tenantid, nodeid, fname, params).ToString())
-
-	kvs := gad.ws.Get(s)
+	kvs := gad.execAgent(sysid, tenantid, nodeid, fname, params)
 	if len(kvs) == 0 {
 		return nil, &FError{"AssignNodeFloatingIP function replied nil", nil}
 	}
@@ -2015,9 +2228,7 @@ func (gad *GAD) RetainNodeFloatingIP(sysid string, tenantid string, nodeid strin
 	params["floating_uuid"] = ipid
 	params["cp_uuid"] = cpid
 
-	s, _ := yaks.NewSelector(gad.GetAgentExecSelectorWithParams(sysid, tenantid, nodeid, fname, params).ToString())
-
-	kvs := gad.ws.Get(s)
+	kvs := gad.execAgent(sysid, tenantid, nodeid, fname, params)
 	if len(kvs) == 0 {
 		return nil, &FError{"RetainNodeFloatingIP function replied nil", nil}
 	}
@@ -2083,9 +2294,7 @@ func (gad *GAD) AddPortToRouter(sysid string, tenantid string, nodeid string, ro
 		params["ip_address"] = *ipaddress
 	}
 
-	s, _ := yaks.NewSelector(gad.GetAgentExecSelectorWithParams(sysid, tenantid, nodeid, fname, params).ToString())
-
-	kvs := gad.ws.Get(s)
+	kvs := gad.execAgent(sysid, tenantid, nodeid, fname, params)
 	if len(kvs) == 0 {
 		return nil, &FError{"AddPortToRouter function replied nil", nil}
 	}
@@ -2145,9 +2354,7 @@ func (gad *GAD) RemovePortFromRouter(sysid string, tenantid string, nodeid strin
 	params["router_id"] = routerid
 	params["vnet_id"] = vnetid
 
-	s, _ := yaks.NewSelector(gad.GetAgentExecSelectorWithParams(sysid, tenantid, nodeid, fname, params).ToString())
-
-	kvs := gad.ws.Get(s)
+	kvs := gad.execAgent(sysid, tenantid, nodeid, fname, params)
 	if len(kvs) == 0 {
 		return nil, &FError{"RemovePortFromRouter function replied nil", nil}
 	}
@@ -2204,13 +2411,16 @@ func (gad *GAD) OnboardFDUFromNode(sysid string, tenantid string, nodeid string,
 	fname := "onboard_fdu"
 	params := make(map[string]interface{})
 
+	err := NewFlavorCatalog(gad, sysid, tenantid).ResolveFDU(&info)
+	if err != nil {
+		return nil, err
+	}
+
 	d, err := json.Marshal(info)
 
 	params["descriptor"] = string(d)
 
-	s, _ := yaks.NewSelector(gad.GetAgentExecSelectorWithParams(sysid, tenantid, nodeid, fname, params).ToString())
-
-	kvs := gad.ws.Get(s)
+	kvs := gad.execAgent(sysid, tenantid, nodeid, fname, params)
 	if len(kvs) == 0 {
 		return nil, &FError{"OnboardFDUFromNode function replied nil", nil}
 	}
@@ -2269,9 +2479,7 @@ func (gad *GAD) DefineFDUInNode(sysid string, tenantid string, nodeid string, fd
 
 	params["fdu_id"] = fduid
 
-	s, _ := yaks.NewSelector(gad.GetAgentExecSelectorWithParams(sysid, tenantid, nodeid, fname, params).ToString())
-
-	kvs := gad.ws.Get(s)
+	kvs := gad.execAgent(sysid, tenantid, nodeid, fname, params)
 	if len(kvs) == 0 {
 		return nil, &FError{"DefineFDUInNode function replied nil", nil}
 	}
@@ -2412,6 +2620,87 @@ func (gad *GAD) GetFileFDUInNode(sysid string, tenantid string, instanceid strin
 	return &sv, nil
 }
 
+// StreamLogFDUInNode returns a reader on the log of the given instance, the log is transferred in chunks,
+// if follow is true the reader keeps returning the new log lines until it is closed.
+// The stream is opened through the eval of the plugin that manages the instance
+func (gad *GAD) StreamLogFDUInNode(sysid string, tenantid string, instanceid string, follow bool) (io.ReadCloser, error) {
+	nodeid, err := gad.GetFDUInstanceNode(sysid, tenantid, instanceid)
+	if err != nil {
+		return nil, err
+	}
+	return gad.local().StreamLogFDUInNode(nodeid, instanceid, follow)
+}
+
+// StreamFileFDUInNode returns a reader on the given file of the given instance, the file is transferred in chunks.
+// The stream is opened through the eval of the plugin that manages the instance
+func (gad *GAD) StreamFileFDUInNode(sysid string, tenantid string, instanceid string, filename string) (io.ReadCloser, error) {
+	nodeid, err := gad.GetFDUInstanceNode(sysid, tenantid, instanceid)
+	if err != nil {
+		return nil, err
+	}
+	return gad.local().StreamFileFDUInNode(nodeid, instanceid, filename)
+}
+
+// ExecFDUInNode executes a command in the given instance and returns the session connected to it.
+// The session is opened through the eval of the plugin that manages the instance
+func (gad *GAD) ExecFDUInNode(sysid string, tenantid string, instanceid string, req ExecRequest) (*ExecSession, error) {
+	nodeid, err := gad.GetFDUInstanceNode(sysid, tenantid, instanceid)
+	if err != nil {
+		return nil, err
+	}
+	return gad.local().ExecFDUInNode(nodeid, instanceid, req)
+}
+
+// AttachFDUInNode attaches to the console of the given instance and returns the session connected to it.
+// The session is opened through the eval of the plugin that manages the instance
+func (gad *GAD) AttachFDUInNode(sysid string, tenantid string, instanceid string, req ExecRequest) (*ExecSession, error) {
+	nodeid, err := gad.GetFDUInstanceNode(sysid, tenantid, instanceid)
+	if err != nil {
+		return nil, err
+	}
+	return gad.local().AttachFDUInNode(nodeid, instanceid, req)
+}
+
+// local returns the LAD of the local actual store, it shares the session with the GAD
+// and it is used to reach the evals registered by the plugins
+func (gad *GAD) local() *LAD {
+	return &LAD{ws: gad.ws, prefix: LocalActualPrefix}
+}
+
+// openTransfer calls a stream eval, that replies with the path of the transfer, and returns a reader on the transfer
+func openTransfer(ws *yaksSession, s *yaks.Selector, fname string) (io.ReadCloser, error) {
+	path, err := evalSessionPath(ws, s, fname)
+	if err != nil {
+		return nil, err
+	}
+	return newTransferReader(ws, path)
+}
+
+// evalSessionPath calls an eval that replies with the path of a transfer or of a session
+func evalSessionPath(ws *yaksSession, s *yaks.Selector, fname string) (string, error) {
+	kvs := ws.Get(s)
+	if len(kvs) == 0 {
+		return "", &FError{fname + " function replied nil", nil}
+	}
+	v := kvs[0].Value().ToString()
+	sv := EvalResult{}
+	err := json.Unmarshal([]byte(v), &sv)
+	if err != nil {
+		return "", err
+	}
+	if sv.Error != nil {
+		msg := fmt.Sprintf("%s failed with error %d", fname, *sv.Error)
+		if sv.ErrorMessage != nil {
+			msg = msg + ": " + *sv.ErrorMessage
+		}
+		return "", &FError{msg, nil}
+	}
+	if sv.Result == nil {
+		return "", &FError{fname + " replied without path", nil}
+	}
+	return *sv.Result, nil
+}
+
 // CreateNetworkInNode ...
 func (gad *GAD) CreateNetworkInNode(sysid string, tenantid string, nodeid string, netid string, info VirtualNetwork) (*EvalResult, error) {
 
@@ -2422,9 +2711,7 @@ func (gad *GAD) CreateNetworkInNode(sysid string, tenantid string, nodeid string
 
 	params["descriptor"] = string(d)
 
-	s, _ := yaks.NewSelector(gad.GetAgentExecSelectorWithParams(sysid, tenantid, nodeid, fname, params).ToString())
-
-	kvs := gad.ws.Get(s)
+	kvs := gad.execAgent(sysid, tenantid, nodeid, fname, params)
 	if len(kvs) == 0 {
 		return nil, &FError{"CreateNetworkInNode function replied nil", nil}
 	}
@@ -2483,9 +2770,7 @@ func (gad *GAD) RemoveNetworkFromNode(sysid string, tenantid string, nodeid stri
 
 	params["net_id"] = netid
 
-	s, _ := yaks.NewSelector(gad.GetAgentExecSelectorWithParams(sysid, tenantid, nodeid, fname, params).ToString())
-
-	kvs := gad.ws.Get(s)
+	kvs := gad.execAgent(sysid, tenantid, nodeid, fname, params)
 	if len(kvs) == 0 {
 		return nil, &FError{"RemoveNetworkFromNode function replied nil", nil}
 	}
@@ -2538,7 +2823,7 @@ func (gad *GAD) RemoveNetworkFromNode(sysid string, tenantid string, nodeid stri
 
 // LAD is Local Actual Desired
 type LAD struct {
-	ws        *yaks.Workspace
+	ws        *yaksSession
 	prefix    string
 	listeners []*yaks.SubscriptionID
 	evals     []*yaks.Path
@@ -2623,6 +2908,41 @@ func (lad *LAD) GetNodePlguinStatePath(nodeid string, pluginid string) *yaks.Pat
 	return CreatePath([]string{lad.prefix, nodeid, "plugins", pluginid, "state"})
 }
 
+// GetNodePluginStateRecordPath ...
+func (lad *LAD) GetNodePluginStateRecordPath(nodeid string, pluginid string) *yaks.Path {
+	return CreatePath([]string{lad.prefix, nodeid, "plugins", pluginid, "versioned_state"})
+}
+
+// GetNodePluginStateCheckPath ...
+func (lad *LAD) GetNodePluginStateCheckPath(nodeid string, pluginid string) *yaks.Path {
+	return CreatePath([]string{lad.prefix, nodeid, "plugins", pluginid, "state_check"})
+}
+
+// GetNodePluginLogPath ...
+func (lad *LAD) GetNodePluginLogPath(nodeid string, pluginid string, slot int) *yaks.Path {
+	return CreatePath([]string{lad.prefix, nodeid, "plugins", pluginid, "logs", strconv.Itoa(slot)})
+}
+
+// GetNodePluginLogsSelector ...
+func (lad *LAD) GetNodePluginLogsSelector(nodeid string, pluginid string) *yaks.Selector {
+	return CreateSelector([]string{lad.prefix, nodeid, "plugins", pluginid, "logs", "*"})
+}
+
+// GetNodePluginHeartbeatPath ...
+func (lad *LAD) GetNodePluginHeartbeatPath(nodeid string, pluginid string) *yaks.Path {
+	return CreatePath([]string{lad.prefix, nodeid, "plugins", pluginid, "heartbeat"})
+}
+
+// GetNodePluginLivenessPath ...
+func (lad *LAD) GetNodePluginLivenessPath(nodeid string, pluginid string) *yaks.Path {
+	return CreatePath([]string{lad.prefix, nodeid, "plugins", pluginid, "liveness"})
+}
+
+// GetNodePluginsHeartbeatSelector ...
+func (lad *LAD) GetNodePluginsHeartbeatSelector(nodeid string) *yaks.Selector {
+	return CreateSelector([]string{lad.prefix, nodeid, "plugins", "*", "heartbeat"})
+}
+
 // GetNodeRuntimesSelector ...
 func (lad *LAD) GetNodeRuntimesSelector(nodeid string) *yaks.Selector {
 	return CreateSelector([]string{lad.prefix, nodeid, "runtimes", "**"})
@@ -2679,7 +2999,7 @@ func (lad *LAD) GetNoneFDUStartEvalSelector(nodeid string, instanceid string, en
 // GetNodeFDURunEvalSelector ...
 func (lad *LAD) GetNodeFDURunEvalSelector(nodeid string, instanceid string, env string) *yaks.Selector {
 	e := fmt.Sprintf("?(env=%s)", env)
-	return CreateSelector([]string{lad.prefix, nodeid, "runtimes", "*", "fdu", "*", "instances", instanceid, "start", e})
+	return CreateSelector([]string{lad.prefix, nodeid, "runtimes", "*", "fdu", "*", "instances", instanceid, "run", e})
 }
 
 // GetNodeFDULogEvalSelector ...
@@ -2698,6 +3018,30 @@ func (lad *LAD) GetNodeFDUFileEvalSelector(nodeid string, instanceid string, fil
 	return CreateSelector([]string{lad.prefix, nodeid, "runtimes", "*", "fdu", "*", "instances", instanceid, "get", f})
 }
 
+// GetNodeFDULogStreamEvalSelector ...
+func (lad *LAD) GetNodeFDULogStreamEvalSelector(nodeid string, instanceid string, follow bool) *yaks.Selector {
+	f := fmt.Sprintf("?(follow=%t)", follow)
+	return CreateSelector([]string{lad.prefix, nodeid, "runtimes", "*", "fdu", "*", "instances", instanceid, "log_stream", f})
+}
+
+// GetNodeFDUFileStreamEvalSelector ...
+func (lad *LAD) GetNodeFDUFileStreamEvalSelector(nodeid string, instanceid string, filename string) *yaks.Selector {
+	f := fmt.Sprintf("?(filename=%s)", filename)
+	return CreateSelector([]string{lad.prefix, nodeid, "runtimes", "*", "fdu", "*", "instances", instanceid, "get_stream", f})
+}
+
+// GetNodeFDUExecEvalSelector ...
+func (lad *LAD) GetNodeFDUExecEvalSelector(nodeid string, instanceid string, request string) *yaks.Selector {
+	f := fmt.Sprintf("?(request=%s)", request)
+	return CreateSelector([]string{lad.prefix, nodeid, "runtimes", "*", "fdu", "*", "instances", instanceid, "exec", f})
+}
+
+// GetNodeFDUAttachEvalSelector ...
+func (lad *LAD) GetNodeFDUAttachEvalSelector(nodeid string, instanceid string, request string) *yaks.Selector {
+	f := fmt.Sprintf("?(request=%s)", request)
+	return CreateSelector([]string{lad.prefix, nodeid, "runtimes", "*", "fdu", "*", "instances", instanceid, "attach", f})
+}
+
 // GetNodeFDUStartEvalPath ...
 func (lad *LAD) GetNodeFDUStartEvalPath(nodeid string, pluginid string, fduid string, instanceid string) *yaks.Path {
 	return CreatePath([]string{lad.prefix, nodeid, "runtimes", pluginid, "fdu", fduid, "instances", instanceid, "start"})
@@ -2723,6 +3067,46 @@ func (lad *LAD) GetNodeFDUFileEvalPath(nodeid string, pluginid string, fduid str
 	return CreatePath([]string{lad.prefix, nodeid, "runtimes", pluginid, "fdu", fduid, "instances", instanceid, "get"})
 }
 
+// GetNodeFDULogStreamEvalPath ...
+func (lad *LAD) GetNodeFDULogStreamEvalPath(nodeid string, pluginid string, fduid string, instanceid string) *yaks.Path {
+	return CreatePath([]string{lad.prefix, nodeid, "runtimes", pluginid, "fdu", fduid, "instances", instanceid, "log_stream"})
+}
+
+// GetNodeFDUFileStreamEvalPath ...
+func (lad *LAD) GetNodeFDUFileStreamEvalPath(nodeid string, pluginid string, fduid string, instanceid string) *yaks.Path {
+	return CreatePath([]string{lad.prefix, nodeid, "runtimes", pluginid, "fdu", fduid, "instances", instanceid, "get_stream"})
+}
+
+// GetNodeFDUTransferPath ...
+func (lad *LAD) GetNodeFDUTransferPath(nodeid string, pluginid string, fduid string, instanceid string, transferid string) *yaks.Path {
+	return CreatePath([]string{lad.prefix, nodeid, "runtimes", pluginid, "fdu", fduid, "instances", instanceid, "transfers", transferid})
+}
+
+// GetNodeFDUExecEvalPath ...
+func (lad *LAD) GetNodeFDUExecEvalPath(nodeid string, pluginid string, fduid string, instanceid string) *yaks.Path {
+	return CreatePath([]string{lad.prefix, nodeid, "runtimes", pluginid, "fdu", fduid, "instances", instanceid, "exec"})
+}
+
+// GetNodeFDUAttachEvalPath ...
+func (lad *LAD) GetNodeFDUAttachEvalPath(nodeid string, pluginid string, fduid string, instanceid string) *yaks.Path {
+	return CreatePath([]string{lad.prefix, nodeid, "runtimes", pluginid, "fdu", fduid, "instances", instanceid, "attach"})
+}
+
+// GetNodeFDUSessionPath ...
+func (lad *LAD) GetNodeFDUSessionPath(nodeid string, pluginid string, fduid string, instanceid string, sessionid string) *yaks.Path {
+	return CreatePath([]string{lad.prefix, nodeid, "runtimes", pluginid, "fdu", fduid, "instances", instanceid, "sessions", sessionid})
+}
+
+// GetNodeFDUInstanceMetricsPath ...
+func (lad *LAD) GetNodeFDUInstanceMetricsPath(nodeid string, pluginid string, fduid string, instanceid string, slot int) *yaks.Path {
+	return CreatePath([]string{lad.prefix, nodeid, "runtimes", pluginid, "fdu", fduid, "instances", instanceid, "metrics", strconv.Itoa(slot)})
+}
+
+// GetNodeFDUInstanceMetricsSelector ...
+func (lad *LAD) GetNodeFDUInstanceMetricsSelector(nodeid string, pluginid string, fduid string, instanceid string) *yaks.Selector {
+	return CreateSelector([]string{lad.prefix, nodeid, "runtimes", pluginid, "fdu", fduid, "instances", instanceid, "metrics", "*"})
+}
+
 // Node Images
 
 // GetNodeIimageInfoPath ...
@@ -2907,6 +3291,7 @@ func (lad *LAD) ExtractNodeFloatingIPIDFromPath(path *yaks.Path) string {
 func (lad *LAD) AddOSEval(nodeid string, funcname string, evalcb func(yaks.Properties) interface{}) error {
 	s := lad.GetNodeOSExecPath(nodeid, funcname)
 
+	evalcb = traceEval(lad.ws.tracing(), funcname, evalcb)
 	cb := func(path *yaks.Path, props yaks.Properties) yaks.Value {
 		v, _ := json.Marshal(evalcb(props))
 		sv := yaks.NewStringValue(string(v))
@@ -2922,6 +3307,7 @@ func (lad *LAD) AddOSEval(nodeid string, funcname string, evalcb func(yaks.Prope
 func (lad *LAD) AddNMEval(nodeid string, pluginid string, funcname string, evalcb func(yaks.Properties) interface{}) error {
 	s := lad.GetNodeNMExecPath(nodeid, pluginid, funcname)
 
+	evalcb = traceEval(lad.ws.tracing(), funcname, evalcb)
 	cb := func(path *yaks.Path, props yaks.Properties) yaks.Value {
 		v, _ := json.Marshal(evalcb(props))
 		sv := yaks.NewStringValue(string(v))
@@ -2937,6 +3323,7 @@ func (lad *LAD) AddNMEval(nodeid string, pluginid string, funcname string, evalc
 func (lad *LAD) AddPluginEval(nodeid string, pluginid string, funcname string, evalcb func(yaks.Properties) interface{}) error {
 	s := lad.GetNodePluginEvalPath(nodeid, pluginid, funcname)
 
+	evalcb = traceEval(lad.ws.tracing(), funcname, evalcb)
 	cb := func(path *yaks.Path, props yaks.Properties) yaks.Value {
 		v, _ := json.Marshal(evalcb(props))
 		sv := yaks.NewStringValue(string(v))
@@ -2960,7 +3347,7 @@ func (lad *LAD) AddPluginFDUStartEval(nodeid string, pluginid string, fduid stri
 			sv := yaks.NewStringValue(string(yv))
 			return sv
 		}
-		return yaks.NewStringValue(fmt.Sprintf("{\"error\":\"Missing parameter Env\""))
+		return missingParameterValue("env")
 	}
 
 	err := lad.ws.RegisterEval(s, cb)
@@ -2980,7 +3367,7 @@ func (lad *LAD) AddPluginFDURunEval(nodeid string, pluginid string, fduid string
 			sv := yaks.NewStringValue(string(yv))
 			return sv
 		}
-		return yaks.NewStringValue(fmt.Sprintf("{\"error\":\"Missing parameter Env\""))
+		return missingParameterValue("env")
 	}
 
 	err := lad.ws.RegisterEval(s, cb)
@@ -3036,7 +3423,7 @@ func (lad *LAD) AddPluginFDUFileEval(nodeid string, pluginid string, fduid strin
 			sv := yaks.NewStringValue(string(yv))
 			return sv
 		}
-		return yaks.NewStringValue(fmt.Sprintf("{\"error\":\"Missing parameter filename\""))
+		return missingParameterValue("filename")
 	}
 
 	err := lad.ws.RegisterEval(s, cb)
@@ -3044,6 +3431,94 @@ func (lad *LAD) AddPluginFDUFileEval(nodeid string, pluginid string, fduid strin
 	return err
 }
 
+// AddPluginFDULogStreamEval registers the log stream eval, the callback receives the follow parameter
+// and replies with the path of the transfer
+func (lad *LAD) AddPluginFDULogStreamEval(nodeid string, pluginid string, fduid string, instanceid string, evalcb func(bool) EvalResult) error {
+	s := lad.GetNodeFDULogStreamEvalPath(nodeid, pluginid, fduid, instanceid)
+
+	cb := func(path *yaks.Path, props yaks.Properties) yaks.Value {
+		follow := props["follow"] == "true"
+		v := evalcb(follow)
+		yv, _ := json.Marshal(v)
+		sv := yaks.NewStringValue(string(yv))
+		return sv
+	}
+
+	err := lad.ws.RegisterEval(s, cb)
+	lad.evals = append(lad.evals, s)
+	return err
+}
+
+// AddPluginFDUFileStreamEval registers the file stream eval, the callback replies with the path of the transfer
+func (lad *LAD) AddPluginFDUFileStreamEval(nodeid string, pluginid string, fduid string, instanceid string, evalcb func(*string) EvalResult) error {
+	s := lad.GetNodeFDUFileStreamEvalPath(nodeid, pluginid, fduid, instanceid)
+
+	cb := func(path *yaks.Path, props yaks.Properties) yaks.Value {
+		fName, found := props["filename"]
+		if found {
+			v := evalcb(&fName)
+			yv, _ := json.Marshal(v)
+			sv := yaks.NewStringValue(string(yv))
+			return sv
+		}
+		return missingParameterValue("filename")
+	}
+
+	err := lad.ws.RegisterEval(s, cb)
+	lad.evals = append(lad.evals, s)
+	return err
+}
+
+// AddPluginFDUExecEval registers the exec eval, the callback replies with the path of the session
+func (lad *LAD) AddPluginFDUExecEval(nodeid string, pluginid string, fduid string, instanceid string, evalcb func(ExecRequest) EvalResult) error {
+	s := lad.GetNodeFDUExecEvalPath(nodeid, pluginid, fduid, instanceid)
+	err := lad.ws.RegisterEval(s, execEval(evalcb))
+	lad.evals = append(lad.evals, s)
+	return err
+}
+
+// AddPluginFDUAttachEval registers the attach eval, the callback replies with the path of the session
+func (lad *LAD) AddPluginFDUAttachEval(nodeid string, pluginid string, fduid string, instanceid string, evalcb func(ExecRequest) EvalResult) error {
+	s := lad.GetNodeFDUAttachEvalPath(nodeid, pluginid, fduid, instanceid)
+	err := lad.ws.RegisterEval(s, execEval(evalcb))
+	lad.evals = append(lad.evals, s)
+	return err
+}
+
+// execEval decodes the request parameter of the exec and attach evals
+func execEval(evalcb func(ExecRequest) EvalResult) yaks.Eval {
+	return func(path *yaks.Path, props yaks.Properties) yaks.Value {
+		r, found := props["request"]
+		if !found {
+			return missingParameterValue("request")
+		}
+		req, err := decodeExecRequest(r)
+		if err != nil {
+			return invalidParameterValue("request")
+		}
+		v := evalcb(*req)
+		yv, _ := json.Marshal(v)
+		sv := yaks.NewStringValue(string(yv))
+		return sv
+	}
+}
+
+// missingParameterValue returns the EvalResult replied by an eval when a parameter is missing
+func missingParameterValue(param string) yaks.Value {
+	code := 22 // EINVAL
+	msg := "Missing parameter " + param
+	yv, _ := json.Marshal(EvalResult{Error: &code, ErrorMessage: &msg})
+	return yaks.NewStringValue(string(yv))
+}
+
+// invalidParameterValue returns the EvalResult replied by an eval when a parameter cannot be decoded
+func invalidParameterValue(param string) yaks.Value {
+	code := 22 // EINVAL
+	msg := "Invalid parameter " + param
+	yv, _ := json.Marshal(EvalResult{Error: &code, ErrorMessage: &msg})
+	return yaks.NewStringValue(string(yv))
+}
+
 // RemovePluginFDUStartEval ...
 func (lad *LAD) RemovePluginFDUStartEval(nodeid string, pluginid string, fduid string, instanceid string) error {
 	s := lad.GetNodeFDUStartEvalPath(nodeid, pluginid, fduid, instanceid)
@@ -3079,9 +3554,38 @@ func (lad *LAD) RemovePluginFDUFileEval(nodeid string, pluginid string, fduid st
 	return r
 }
 
+// RemovePluginFDULogStreamEval ...
+func (lad *LAD) RemovePluginFDULogStreamEval(nodeid string, pluginid string, fduid string, instanceid string) error {
+	s := lad.GetNodeFDULogStreamEvalPath(nodeid, pluginid, fduid, instanceid)
+	r := lad.ws.UnregisterEval(s)
+	return r
+}
+
+// RemovePluginFDUFileStreamEval ...
+func (lad *LAD) RemovePluginFDUFileStreamEval(nodeid string, pluginid string, fduid string, instanceid string) error {
+	s := lad.GetNodeFDUFileStreamEvalPath(nodeid, pluginid, fduid, instanceid)
+	r := lad.ws.UnregisterEval(s)
+	return r
+}
+
+// RemovePluginFDUExecEval ...
+func (lad *LAD) RemovePluginFDUExecEval(nodeid string, pluginid string, fduid string, instanceid string) error {
+	s := lad.GetNodeFDUExecEvalPath(nodeid, pluginid, fduid, instanceid)
+	r := lad.ws.UnregisterEval(s)
+	return r
+}
+
+// RemovePluginFDUAttachEval ...
+func (lad *LAD) RemovePluginFDUAttachEval(nodeid string, pluginid string, fduid string, instanceid string) error {
+	s := lad.GetNodeFDUAttachEvalPath(nodeid, pluginid, fduid, instanceid)
+	r := lad.ws.UnregisterEval(s)
+	return r
+}
+
 // ExecAgentEval ...
 func (lad *LAD) ExecAgentEval(nodeid string, fname string, props map[string]interface{}) (*EvalResult, error) {
 
+	span, props := startEvalCall(lad.ws.tracing(), fname, props)
 	var s *yaks.Selector
 	if len(props) == 0 {
 		s, _ = yaks.NewSelector(lad.GetAgentExecPath(nodeid, fname).ToString())
@@ -3090,6 +3594,7 @@ func (lad *LAD) ExecAgentEval(nodeid string, fname string, props map[string]inte
 	}
 
 	kvs := lad.ws.Get(s)
+	finishEvalCall(span, kvs)
 	if len(kvs) == 0 {
 		return nil, &FError{"ExecAgentEval function replied nil", nil}
 	}
@@ -3143,6 +3648,7 @@ func (lad *LAD) ExecAgentEval(nodeid string, fname string, props map[string]inte
 // ExecOSEval ...
 func (lad *LAD) ExecOSEval(nodeid string, fname string, props map[string]interface{}) (*EvalResult, error) {
 
+	span, props := startEvalCall(lad.ws.tracing(), fname, props)
 	var s *yaks.Selector
 	if len(props) == 0 {
 		s, _ = yaks.NewSelector(lad.GetNodeOSExecPath(nodeid, fname).ToString())
@@ -3151,6 +3657,7 @@ func (lad *LAD) ExecOSEval(nodeid string, fname string, props map[string]interfa
 	}
 
 	kvs := lad.ws.Get(s)
+	finishEvalCall(span, kvs)
 	if len(kvs) == 0 {
 		return nil, &FError{"ExecOSEval function replied nil", nil}
 	}
@@ -3204,6 +3711,7 @@ func (lad *LAD) ExecOSEval(nodeid string, fname string, props map[string]interfa
 // ExecNMEval ...
 func (lad *LAD) ExecNMEval(nodeid string, pluginid string, fname string, props map[string]interface{}) (*EvalResult, error) {
 
+	span, props := startEvalCall(lad.ws.tracing(), fname, props)
 	var s *yaks.Selector
 	if len(props) == 0 {
 		s, _ = yaks.NewSelector(lad.GetNodeNMExecPath(nodeid, pluginid, fname).ToString())
@@ -3212,6 +3720,7 @@ func (lad *LAD) ExecNMEval(nodeid string, pluginid string, fname string, props m
 	}
 
 	kvs := lad.ws.Get(s)
+	finishEvalCall(span, kvs)
 	if len(kvs) == 0 {
 		return nil, &FError{"ExecNMEval function replied nil", nil}
 	}
@@ -3265,6 +3774,7 @@ func (lad *LAD) ExecNMEval(nodeid string, pluginid string, fname string, props m
 // ExecPluginEval ...
 func (lad *LAD) ExecPluginEval(nodeid string, pluginid string, fname string, props map[string]interface{}) (*EvalResult, error) {
 
+	span, props := startEvalCall(lad.ws.tracing(), fname, props)
 	var s *yaks.Selector
 	if len(props) == 0 {
 		s, _ = yaks.NewSelector(lad.GetNodePluginEvalPath(nodeid, pluginid, fname).ToString())
@@ -3273,6 +3783,7 @@ func (lad *LAD) ExecPluginEval(nodeid string, pluginid string, fname string, pro
 	}
 
 	kvs := lad.ws.Get(s)
+	finishEvalCall(span, kvs)
 	if len(kvs) == 0 {
 		return nil, &FError{"ExecPluginEval function replied nil", nil}
 	}
@@ -3323,6 +3834,49 @@ func (lad *LAD) ExecPluginEval(nodeid string, pluginid string, fname string, pro
 
 }
 
+// StreamLogFDUInNode returns a reader on the log of the given instance running in the given node,
+// if follow is true the reader keeps returning the new log lines until it is closed
+func (lad *LAD) StreamLogFDUInNode(nodeid string, instanceid string, follow bool) (io.ReadCloser, error) {
+	s := lad.GetNodeFDULogStreamEvalSelector(nodeid, instanceid, follow)
+	return openTransfer(lad.ws, s, "StreamLogFDUInNode")
+}
+
+// StreamFileFDUInNode returns a reader on the given file of the given instance running in the given node
+func (lad *LAD) StreamFileFDUInNode(nodeid string, instanceid string, filename string) (io.ReadCloser, error) {
+	s := lad.GetNodeFDUFileStreamEvalSelector(nodeid, instanceid, filename)
+	return openTransfer(lad.ws, s, "StreamFileFDUInNode")
+}
+
+// ExecFDUInNode executes a command in the given instance running in the given node
+// and returns the session connected to it
+func (lad *LAD) ExecFDUInNode(nodeid string, instanceid string, req ExecRequest) (*ExecSession, error) {
+	r, err := encodeExecRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	s := lad.GetNodeFDUExecEvalSelector(nodeid, instanceid, r)
+	path, err := evalSessionPath(lad.ws, s, "ExecFDUInNode")
+	if err != nil {
+		return nil, err
+	}
+	return newExecSession(lad.ws, path)
+}
+
+// AttachFDUInNode attaches to the console of the given instance running in the given node
+// and returns the session connected to it
+func (lad *LAD) AttachFDUInNode(nodeid string, instanceid string, req ExecRequest) (*ExecSession, error) {
+	r, err := encodeExecRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	s := lad.GetNodeFDUAttachEvalSelector(nodeid, instanceid, r)
+	path, err := evalSessionPath(lad.ws, s, "AttachFDUInNode")
+	if err != nil {
+		return nil, err
+	}
+	return newExecSession(lad.ws, path)
+}
+
 // Node
 
 // AddNodePlugin ...
@@ -3388,7 +3942,7 @@ func (lad *LAD) AddNodePluginState(nodeid string, pluginid string, state map[str
 
 // GetNodePluginState ...
 func (lad *LAD) GetNodePluginState(nodeid string, pluginid string) (*map[string]interface{}, error) {
-	s, _ := yaks.NewSelector(lad.GetNodePlguinInfoPath(nodeid, pluginid).ToString())
+	s, _ := yaks.NewSelector(lad.GetNodePlguinStatePath(nodeid, pluginid).ToString())
 	kvs := lad.ws.Get(s)
 	if len(kvs) == 0 {
 		return nil, &FError{"Plugin not Found", nil}
@@ -3404,11 +3958,202 @@ func (lad *LAD) GetNodePluginState(nodeid string, pluginid string) (*map[string]
 
 // RemoveNodePluginState ...
 func (lad *LAD) RemoveNodePluginState(nodeid string, pluginid string) error {
-	s := lad.GetNodePlguinInfoPath(nodeid, pluginid)
+	s := lad.GetNodePlguinStatePath(nodeid, pluginid)
+	err := lad.ws.Remove(s)
+	return err
+}
+
+// AddNodePluginStateRecord ...
+func (lad *LAD) AddNodePluginStateRecord(nodeid string, pluginid string, record PluginStateRecord) error {
+	s := lad.GetNodePluginStateRecordPath(nodeid, pluginid)
+	v, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	sv := yaks.NewStringValue(string(v))
+	err = lad.ws.Put(s, sv)
+	return err
+}
+
+// GetNodePluginStateRecord ...
+func (lad *LAD) GetNodePluginStateRecord(nodeid string, pluginid string) (*PluginStateRecord, error) {
+	s, _ := yaks.NewSelector(lad.GetNodePluginStateRecordPath(nodeid, pluginid).ToString())
+	kvs := lad.ws.Get(s)
+	if len(kvs) == 0 {
+		return nil, &FError{"Plugin State not Found", nil}
+	}
+	v := kvs[0].Value().ToString()
+	sv := PluginStateRecord{}
+	err := json.Unmarshal([]byte(v), &sv)
+	if err != nil {
+		return nil, err
+	}
+	return &sv, nil
+}
+
+// RemoveNodePluginStateRecord ...
+func (lad *LAD) RemoveNodePluginStateRecord(nodeid string, pluginid string) error {
+	s := lad.GetNodePluginStateRecordPath(nodeid, pluginid)
+	err := lad.ws.Remove(s)
+	return err
+}
+
+// CheckNodePluginStateStore checks that the store of the plugin state is reachable by writing a value
+// and reading it back, YAKS does not report the errors of a get
+func (lad *LAD) CheckNodePluginStateStore(nodeid string, pluginid string) bool {
+	p := lad.GetNodePluginStateCheckPath(nodeid, pluginid)
+	v := uuid.UUID.String(uuid.New())
+	if lad.ws.Put(p, yaks.NewStringValue(v)) != nil {
+		return false
+	}
+	defer lad.ws.Remove(p)
+	s, _ := yaks.NewSelector(p.ToString())
+	kvs := lad.ws.Get(s)
+	return len(kvs) > 0 && kvs[0].Value().ToString() == v
+}
+
+// AddNodePluginLog stores a log record of the plugin in the given slot of its history
+func (lad *LAD) AddNodePluginLog(nodeid string, pluginid string, slot int, record PluginLogRecord) error {
+	s := lad.GetNodePluginLogPath(nodeid, pluginid, slot)
+	v, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	sv := yaks.NewStringValue(string(v))
+	err = lad.ws.Put(s, sv)
+	return err
+}
+
+// GetNodePluginLogs returns the log records of the plugin sorted by time
+func (lad *LAD) GetNodePluginLogs(nodeid string, pluginid string) ([]PluginLogRecord, error) {
+	s := lad.GetNodePluginLogsSelector(nodeid, pluginid)
+	res := []PluginLogRecord{}
+	for _, kv := range lad.ws.Get(s) {
+		sv := PluginLogRecord{}
+		err := json.Unmarshal([]byte(kv.Value().ToString()), &sv)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, sv)
+	}
+	sortLogRecords(res)
+	return res, nil
+}
+
+// RemoveNodePluginLogs removes the log records of the plugin
+func (lad *LAD) RemoveNodePluginLogs(nodeid string, pluginid string) error {
+	s := lad.GetNodePluginLogsSelector(nodeid, pluginid)
+	for _, kv := range lad.ws.Get(s) {
+		err := lad.ws.Remove(kv.Path())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddNodePluginHeartbeat ...
+func (lad *LAD) AddNodePluginHeartbeat(nodeid string, pluginid string, info PluginHeartbeat) error {
+	s := lad.GetNodePluginHeartbeatPath(nodeid, pluginid)
+	v, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	sv := yaks.NewStringValue(string(v))
+	err = lad.ws.Put(s, sv)
+	return err
+}
+
+// RemoveNodePluginHeartbeat ...
+func (lad *LAD) RemoveNodePluginHeartbeat(nodeid string, pluginid string) error {
+	s := lad.GetNodePluginHeartbeatPath(nodeid, pluginid)
 	err := lad.ws.Remove(s)
 	return err
 }
 
+// AddNodePluginLiveness ...
+func (lad *LAD) AddNodePluginLiveness(nodeid string, pluginid string, info PluginLiveness) error {
+	s := lad.GetNodePluginLivenessPath(nodeid, pluginid)
+	v, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	sv := yaks.NewStringValue(string(v))
+	err = lad.ws.Put(s, sv)
+	return err
+}
+
+// GetNodePluginLiveness ...
+func (lad *LAD) GetNodePluginLiveness(nodeid string, pluginid string) (*PluginLiveness, error) {
+	s, _ := yaks.NewSelector(lad.GetNodePluginLivenessPath(nodeid, pluginid).ToString())
+	kvs := lad.ws.Get(s)
+	if len(kvs) == 0 {
+		return nil, &FError{"Plugin liveness not found", nil}
+	}
+	v := kvs[0].Value().ToString()
+	sv := PluginLiveness{}
+	err := json.Unmarshal([]byte(v), &sv)
+	if err != nil {
+		return nil, err
+	}
+	return &sv, nil
+}
+
+// RemoveNodePluginLiveness ...
+func (lad *LAD) RemoveNodePluginLiveness(nodeid string, pluginid string) error {
+	s := lad.GetNodePluginLivenessPath(nodeid, pluginid)
+	err := lad.ws.Remove(s)
+	return err
+}
+
+// GetAllNodePluginsHeartbeats ...
+func (lad *LAD) GetAllNodePluginsHeartbeats(nodeid string) ([]PluginHeartbeat, error) {
+	s := lad.GetNodePluginsHeartbeatSelector(nodeid)
+	kvs := lad.ws.Get(s)
+	var hbs []PluginHeartbeat = []PluginHeartbeat{}
+	for _, kv := range kvs {
+		v := kv.Value().ToString()
+		sv := PluginHeartbeat{}
+		err := json.Unmarshal([]byte(v), &sv)
+		if err != nil {
+			return nil, err
+		}
+		hbs = append(hbs, sv)
+	}
+	return hbs, nil
+}
+
+// ObserveNodePluginsHeartbeats ...
+func (lad *LAD) ObserveNodePluginsHeartbeats(nodeid string, listener func(string, *PluginHeartbeat, bool)) (*yaks.SubscriptionID, error) {
+	s := lad.GetNodePluginsHeartbeatSelector(nodeid)
+
+	cb := func(kvs []yaks.Change) {
+		for _, v := range kvs {
+			pid := lad.ExtractPluginIDFromPath(v.Path())
+			switch v.Kind() {
+			case yaks.REMOVE:
+				listener(pid, nil, true)
+			default:
+				v := v.Value().ToString()
+				sv := PluginHeartbeat{}
+				err := json.Unmarshal([]byte(v), &sv)
+				if err != nil {
+					lad.ws.log().WithField("plugin", pid).Error("Unable to decode plugin heartbeat: " + err.Error())
+					continue
+				}
+				listener(pid, &sv, false)
+			}
+		}
+	}
+
+	sid, err := lad.ws.Subscribe(s, cb)
+	if err != nil {
+		return nil, err
+	}
+	lad.listeners = append(lad.listeners, sid)
+	return sid, nil
+}
+
 // AddNodeInformation ...
 func (lad *LAD) AddNodeInformation(nodeid string, info NodeInfo) error {
 	s := lad.GetNodeInfoPath(nodeid)
@@ -3610,6 +4355,37 @@ func (lad *LAD) ObserveNodePlugins(nodeid string, listener func(Plugin)) (*yaks.
 	return sid, nil
 }
 
+// ObserveNodePluginsChanges ...
+func (lad *LAD) ObserveNodePluginsChanges(nodeid string, listener func(string, *Plugin, bool)) (*yaks.SubscriptionID, error) {
+	s := lad.GetNodePlguinsSelector(nodeid)
+
+	cb := func(kvs []yaks.Change) {
+		for _, v := range kvs {
+			pid := lad.ExtractPluginIDFromPath(v.Path())
+			switch v.Kind() {
+			case yaks.REMOVE:
+				listener(pid, nil, true)
+			default:
+				v := v.Value().ToString()
+				sv := Plugin{}
+				err := json.Unmarshal([]byte(v), &sv)
+				if err != nil {
+					lad.ws.log().WithField("plugin", pid).Error("Unable to decode plugin information: " + err.Error())
+					continue
+				}
+				listener(pid, &sv, false)
+			}
+		}
+	}
+
+	sid, err := lad.ws.Subscribe(s, cb)
+	if err != nil {
+		return nil, err
+	}
+	lad.listeners = append(lad.listeners, sid)
+	return sid, nil
+}
+
 // AddNodeOSInfo ...
 func (lad *LAD) AddNodeOSInfo(nodeid string, info map[string]interface{}) error {
 	s := lad.GetNodeOSInfoPath(nodeid)
@@ -3690,6 +4466,35 @@ func (lad *LAD) RemoveNodeFDU(nodeid string, pluginid string, fduid string, inst
 	return err
 }
 
+// AddNodeFDUInstanceMetrics stores a metrics sample of the instance in the given slot of its history
+func (lad *LAD) AddNodeFDUInstanceMetrics(nodeid string, pluginid string, fduid string, instanceid string, slot int, info FDUMetrics) error {
+	s := lad.GetNodeFDUInstanceMetricsPath(nodeid, pluginid, fduid, instanceid, slot)
+	v, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	sv := yaks.NewStringValue(string(v))
+	err = lad.ws.Put(s, sv)
+	return err
+}
+
+// GetNodeFDUInstanceMetrics returns the metrics samples of the instance sorted by timestamp
+func (lad *LAD) GetNodeFDUInstanceMetrics(nodeid string, pluginid string, fduid string, instanceid string) ([]FDUMetrics, error) {
+	return getMetrics(lad.ws, lad.GetNodeFDUInstanceMetricsSelector(nodeid, pluginid, fduid, instanceid))
+}
+
+// RemoveNodeFDUInstanceMetrics removes the metrics history of the instance
+func (lad *LAD) RemoveNodeFDUInstanceMetrics(nodeid string, pluginid string, fduid string, instanceid string) error {
+	s := lad.GetNodeFDUInstanceMetricsSelector(nodeid, pluginid, fduid, instanceid)
+	for _, kv := range lad.ws.Get(s) {
+		err := lad.ws.Remove(kv.Path())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // GetNodeFDU ...
 func (lad *LAD) GetNodeFDU(nodeid string, pluginid string, fduid string, instanceid string) (*FDURecord, error) {
 	s := lad.GetNodeRuntimeFDUInfoSelector(nodeid, pluginid, fduid, instanceid)
@@ -4181,66 +4986,98 @@ func (lad *LAD) ObserveNodeFloatingIPs(nodeid string, pluginid string, listener
 
 // Global is Global Actual and Desired
 type Global struct {
-	ws      *yaks.Workspace
+	ws      *yaksSession
 	Actual  GAD
 	Desired GAD
 }
 
 // NewGlobal ...
 func NewGlobal(wspace *yaks.Workspace) Global {
-	ac := GAD{evals: []*yaks.Path{}, listeners: []*yaks.SubscriptionID{}, prefix: GlobalActualPrefix, ws: wspace}
-	ds := GAD{evals: []*yaks.Path{}, listeners: []*yaks.SubscriptionID{}, prefix: GlobalDesiredPrefix, ws: wspace}
-	return Global{ws: wspace, Actual: ac, Desired: ds}
+	return newGlobal(newStaticSession(wspace))
+}
+
+func newGlobal(session *yaksSession) Global {
+	ac := GAD{evals: []*yaks.Path{}, listeners: []*yaks.SubscriptionID{}, prefix: GlobalActualPrefix, ws: session}
+	ds := GAD{evals: []*yaks.Path{}, listeners: []*yaks.SubscriptionID{}, prefix: GlobalDesiredPrefix, ws: session}
+	return Global{ws: session, Actual: ac, Desired: ds}
 
 }
 
 // Local is Global Actual and Desired
 type Local struct {
-	ws      *yaks.Workspace
+	ws      *yaksSession
 	Actual  LAD
 	Desired LAD
 }
 
 // NewLocal ...
 func NewLocal(wspace *yaks.Workspace) Local {
-	ac := LAD{evals: []*yaks.Path{}, listeners: []*yaks.SubscriptionID{}, prefix: LocalActualPrefix, ws: wspace}
-	ds := LAD{evals: []*yaks.Path{}, listeners: []*yaks.SubscriptionID{}, prefix: LocalDesiredPrefix, ws: wspace}
-	return Local{ws: wspace, Actual: ac, Desired: ds}
+	return newLocal(newStaticSession(wspace))
+}
+
+func newLocal(session *yaksSession) Local {
+	ac := LAD{evals: []*yaks.Path{}, listeners: []*yaks.SubscriptionID{}, prefix: LocalActualPrefix, ws: session}
+	ds := LAD{evals: []*yaks.Path{}, listeners: []*yaks.SubscriptionID{}, prefix: LocalDesiredPrefix, ws: session}
+	return Local{ws: session, Actual: ac, Desired: ds}
 }
 
 // YaksConnector is Yaks Connector
 type YaksConnector struct {
-	yclient *yaks.Yaks
-	yadmin  *yaks.Admin
-	ws      *yaks.Workspace
+	session *yaksSession
 	Global  Global
 	Local   Local
 }
 
 // Close ...
 func (yc *YaksConnector) Close() error {
-	return yc.yclient.Logout()
+	return yc.session.close()
+}
+
+// Logger returns the logger of the connector
+func (yc *YaksConnector) Logger() log.FieldLogger {
+	return yc.session.log()
+}
+
+// SetTracer sets the tracer of the eval calls and of the eval handlers of the connector,
+// nil restores DefaultTracer
+func (yc *YaksConnector) SetTracer(tracer *Tracer) {
+	yc.session.mutex.Lock()
+	defer yc.session.mutex.Unlock()
+	yc.session.tracer = tracer
+}
+
+// ActiveLocator returns the locator of the YAKS router currently in use
+func (yc *YaksConnector) ActiveLocator() string {
+	return yc.session.activeLocator()
 }
 
 // NewYaksConnector ...
 func NewYaksConnector(locator string) (*YaksConnector, error) {
+	return NewYaksConnectorWithLocators([]string{locator}, PRIORITY)
+}
 
-	y, err := yaks.Login(&locator, nil)
-	if err != nil {
-		return nil, err
-	}
+// NewYaksConnectorWithLocators returns a connector able to fail over between the given YAKS routers,
+// the locators are selected according to the given policy (PRIORITY or ROUNDROBIN).
+// With more than one locator the router in use is probed every LocatorCheckInterval by writing under ProbePrefix
+func NewYaksConnectorWithLocators(locators []string, policy string) (*YaksConnector, error) {
+	return NewYaksConnectorWithLogger(locators, policy, logger)
+}
 
-	ad := y.Admin()
+// NewYaksConnectorWithLogger returns a connector like NewYaksConnectorWithLocators using the given logger
+func NewYaksConnectorWithLogger(locators []string, policy string, logger log.FieldLogger) (*YaksConnector, error) {
+	return NewYaksConnectorWithOptions(locators, policy, ConnectorOptions{Logger: logger})
+}
 
-	wpath, err := yaks.NewPath("/")
+// NewYaksConnectorWithOptions returns a connector like NewYaksConnectorWithLocators using the given credentials,
+// TLS options and logger
+func NewYaksConnectorWithOptions(locators []string, policy string, opts ConnectorOptions) (*YaksConnector, error) {
+	session, err := newFailoverSession(locators, policy, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	ws := y.WorkspaceWithExecutor(wpath)
-
-	g := NewGlobal(ws)
-	l := NewLocal(ws)
+	g := newGlobal(session)
+	l := newLocal(session)
 
-	return &YaksConnector{ws: ws, Global: g, Local: l, yadmin: ad, yclient: y}, nil
+	return &YaksConnector{session: session, Global: g, Local: l}, nil
 }
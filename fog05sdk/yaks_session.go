@@ -0,0 +1,579 @@
+/*
+* Copyright (c) 2014,2019 Contributors to the Eclipse Foundation
+* See the NOTICE file(s) distributed with this work for additional
+* information regarding copyright ownership.
+* This program and the accompanying materials are made available under the
+* terms of the Eclipse Public License 2.0 which is available at
+* http://www.eclipse.org/legal/epl-2.0, or the Apache License, Version 2.0
+* which is available at https://www.apache.org/licenses/LICENSE-2.0.
+* SPDX-License-Identifier: EPL-2.0 OR Apache-2.0
+* Contributors: Gabriele Baldoni, ADLINK Technology Inc.
+* golang APIs
+ */
+
+package fog05sdk
+
+import (
+	"crypto/tls"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atolab/yaks-go"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// PRIORITY is the locator selection policy that always prefers the first reachable locator,
+	// the session goes back to a preferred locator as soon as it is reachable again
+	PRIORITY string = "PRIORITY"
+
+	// ROUNDROBIN is the locator selection policy that moves to the next reachable locator
+	ROUNDROBIN string = "ROUND_ROBIN"
+)
+
+// LocatorCheckInterval is the interval between two liveness checks of the YAKS router in use
+const LocatorCheckInterval = 5 * time.Second
+
+// LocatorFailbackInterval is the interval between two attempts to go back to a preferred locator
+// with the PRIORITY policy
+const LocatorFailbackInterval = 30 * time.Second
+
+// ProbePrefix constant for the path used to check the liveness of the YAKS router
+const ProbePrefix string = "/fosprobe"
+
+var errSessionClosed = &FError{"Connector closed", nil}
+
+type subscriptionRecord struct {
+	selector *yaks.Selector
+	listener yaks.Listener
+	current  *yaks.SubscriptionID
+}
+
+type evalRecord struct {
+	path *yaks.Path
+	eval yaks.Eval
+}
+
+// yaksSession is the session with a YAKS router shared by the GAD and LAD of a connector,
+// it keeps track of subscriptions and evals so that they can be re-established when failing over
+// to another router
+type yaksSession struct {
+	mutex    sync.RWMutex
+	locators []string
+	policy   string
+	active   int
+	client   *yaks.Yaks
+	ws       *yaks.Workspace
+	subs     map[*yaks.SubscriptionID]*subscriptionRecord
+	evals    map[string]*evalRecord
+	probe    *yaks.Path
+	check    chan bool
+	done     chan bool
+	closed   bool
+	logger   log.FieldLogger
+	auditor  *Auditor
+	tracer   *Tracer
+	props    yaks.Properties
+	tlsConf  *tls.Config
+	tunnel   *tlsTunnel
+}
+
+// newStaticSession wraps an already existing workspace, no failover is possible
+func newStaticSession(wspace *yaks.Workspace) *yaksSession {
+	return &yaksSession{ws: wspace, active: -1, subs: map[*yaks.SubscriptionID]*subscriptionRecord{}, evals: map[string]*evalRecord{}}
+}
+
+// newFailoverSession logs in to the first reachable router and, if there are other locators, starts monitoring it
+func newFailoverSession(locators []string, policy string, opts ConnectorOptions) (*yaksSession, error) {
+	if len(locators) == 0 {
+		return nil, &FError{"At least one locator is needed", nil}
+	}
+	if policy != PRIORITY && policy != ROUNDROBIN {
+		return nil, &FError{"Locator policy not recognized: " + policy, nil}
+	}
+	var tlsConf *tls.Config
+	for _, l := range locators {
+		if strings.HasPrefix(l, TLSLocatorPrefix) {
+			conf, err := opts.tlsConfig()
+			if err != nil {
+				return nil, err
+			}
+			tlsConf = conf
+			break
+		}
+	}
+	s := &yaksSession{
+		locators: locators,
+		policy:   policy,
+		active:   -1,
+		subs:     map[*yaks.SubscriptionID]*subscriptionRecord{},
+		evals:    map[string]*evalRecord{},
+		logger:   opts.Logger,
+		props:    opts.properties(),
+		tlsConf:  tlsConf,
+	}
+	// with a single locator there is no router to fail over to, the router is not probed
+	if len(locators) > 1 {
+		s.probe = CreatePath([]string{ProbePrefix, uuid.UUID.String(uuid.New())})
+		s.check = make(chan bool, 1)
+		s.done = make(chan bool)
+	}
+	err := s.failover()
+	if err != nil {
+		return nil, err
+	}
+	if s.probe != nil {
+		go s.monitor()
+	}
+	return s, nil
+}
+
+// log returns the logger of the session, the SDK logger if none was injected
+func (s *yaksSession) log() log.FieldLogger {
+	if s.logger == nil {
+		return logger
+	}
+	return s.logger
+}
+
+func (s *yaksSession) workspace() *yaks.Workspace {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.ws
+}
+
+func (s *yaksSession) activeLocator() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.active < 0 {
+		return ""
+	}
+	return s.locators[s.active]
+}
+
+// candidates returns the indexes of the locators in the order they have to be tried
+func (s *yaksSession) candidates() []int {
+	n := len(s.locators)
+	start := 0
+	if s.policy == ROUNDROBIN && s.active >= 0 {
+		start = s.active + 1
+	}
+	idx := make([]int, n)
+	for i := 0; i < n; i++ {
+		idx[i] = (start + i) % n
+	}
+	return idx
+}
+
+// preferred returns the indexes of the locators preferred to the one in use, only the PRIORITY policy
+// has preferred locators
+func (s *yaksSession) preferred() []int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	idx := []int{}
+	if s.policy != PRIORITY || s.closed {
+		return idx
+	}
+	for i := 0; i < s.active; i++ {
+		idx = append(idx, i)
+	}
+	return idx
+}
+
+// pending returns the subscriptions and evals of the session not restored yet on a workspace,
+// an eval registered again after it was restored is pending again. It is called holding the mutex
+func (s *yaksSession) pending(subs map[*subscriptionRecord]*yaks.SubscriptionID, evals map[string]*evalRecord) ([]*subscriptionRecord, []*evalRecord) {
+	ps := []*subscriptionRecord{}
+	for _, rec := range s.subs {
+		if _, found := subs[rec]; !found {
+			ps = append(ps, rec)
+		}
+	}
+	pe := []*evalRecord{}
+	for k, rec := range s.evals {
+		if evals[k] != rec {
+			pe = append(pe, rec)
+		}
+	}
+	return ps, pe
+}
+
+// restore re-establishes the given subscriptions and evals on the workspace and adds them
+// to the restored ones, it is called without holding the mutex since it blocks until the router replies
+func restore(ws *yaks.Workspace, ps []*subscriptionRecord, pe []*evalRecord, subs map[*subscriptionRecord]*yaks.SubscriptionID, evals map[string]*evalRecord) error {
+	for _, rec := range ps {
+		sid, err := ws.Subscribe(rec.selector, rec.listener)
+		if err != nil {
+			return err
+		}
+		subs[rec] = sid
+	}
+	for _, rec := range pe {
+		k := rec.path.ToString()
+		if _, found := evals[k]; found {
+			ws.UnregisterEval(rec.path)
+		}
+		err := ws.RegisterEval(rec.path, rec.eval)
+		if err != nil {
+			return err
+		}
+		evals[k] = rec
+	}
+	return nil
+}
+
+// failover connects to the next reachable router according to the policy
+func (s *yaksSession) failover() error {
+	s.mutex.RLock()
+	closed := s.closed
+	candidates := s.candidates()
+	s.mutex.RUnlock()
+	if closed {
+		return errSessionClosed
+	}
+	err := s.connect(candidates)
+	if err == nil || err == errSessionClosed {
+		return err
+	}
+	if s.activeLocator() != "" {
+		telemetryReconnections.add(1, []string{"error"})
+	}
+	return err
+}
+
+// failback connects to a reachable router preferred to the one in use, the router in use is kept
+// if none is reachable
+func (s *yaksSession) failback() {
+	candidates := s.preferred()
+	if len(candidates) == 0 {
+		return
+	}
+	err := s.connect(candidates)
+	if err != nil && err != errSessionClosed {
+		s.log().WithField("locator", s.activeLocator()).Debug("Preferred YAKS routers unreachable, " + err.Error())
+	}
+}
+
+// connect logs in to the first reachable router among the candidates and switches the session to it
+func (s *yaksSession) connect(candidates []int) error {
+	var lastErr error
+	for _, i := range candidates {
+		locator := s.locators[i]
+		y, tunnel, err := s.login(locator)
+		if err != nil {
+			s.log().WithFields(log.Fields{"locator": locator, "error": err}).Warn("YAKS router unreachable")
+			lastErr = err
+			continue
+		}
+		err = s.swap(i, y, tunnel)
+		if err == errSessionClosed {
+			return err
+		}
+		if err != nil {
+			s.log().WithFields(log.Fields{"locator": locator, "error": err}).Warn("Unable to restore subscriptions and evals")
+			lastErr = err
+			continue
+		}
+		s.log().WithField("locator", locator).Info("Connected to YAKS router")
+		return nil
+	}
+	return &FError{"No YAKS router reachable", lastErr}
+}
+
+// login logs in to the router of the locator, through a TLS tunnel for a TLS locator,
+// it is called without holding the mutex since it blocks until the router replies
+func (s *yaksSession) login(locator string) (*yaks.Yaks, *tlsTunnel, error) {
+	target := locator
+	var tunnel *tlsTunnel
+	if strings.HasPrefix(locator, TLSLocatorPrefix) {
+		t, err := newTLSTunnel(strings.TrimPrefix(locator, TLSLocatorPrefix), s.tlsConf)
+		if err != nil {
+			return nil, nil, err
+		}
+		tunnel = t
+		target = t.locator()
+	}
+	y, err := yaks.Login(&target, s.props)
+	if err != nil {
+		if tunnel != nil {
+			tunnel.close()
+		}
+		return nil, nil, err
+	}
+	return y, tunnel, nil
+}
+
+// swap restores the subscriptions and evals on the new router and makes it the one in use,
+// the previous one is logged out. On error the new router is logged out.
+// The subscriptions and evals are restored without holding the mutex, those added meanwhile are restored
+// before switching, those removed meanwhile are removed from the new router once it is in use
+func (s *yaksSession) swap(i int, y *yaks.Yaks, tunnel *tlsTunnel) error {
+	wpath, _ := yaks.NewPath("/")
+	ws := y.WorkspaceWithExecutor(wpath)
+	subs := map[*subscriptionRecord]*yaks.SubscriptionID{}
+	evals := map[string]*evalRecord{}
+	var err error
+	for {
+		s.mutex.Lock()
+		if s.closed {
+			err = errSessionClosed
+			break
+		}
+		ps, pe := s.pending(subs, evals)
+		if len(ps) == 0 && len(pe) == 0 {
+			break
+		}
+		s.mutex.Unlock()
+		err = restore(ws, ps, pe, subs, evals)
+		if err != nil {
+			s.mutex.Lock()
+			break
+		}
+	}
+	if err != nil {
+		s.mutex.Unlock()
+		y.Logout()
+		if tunnel != nil {
+			tunnel.close()
+		}
+		return err
+	}
+
+	live := map[*subscriptionRecord]bool{}
+	for _, rec := range s.subs {
+		live[rec] = true
+	}
+	for rec, sid := range subs {
+		if !live[rec] {
+			ws.Unsubscribe(sid)
+			continue
+		}
+		rec.current = sid
+	}
+	for k, rec := range evals {
+		if _, found := s.evals[k]; !found {
+			ws.UnregisterEval(rec.path)
+		}
+	}
+	old := s.client
+	oldTunnel := s.tunnel
+	s.client = y
+	s.ws = ws
+	s.tunnel = tunnel
+	s.active = i
+	s.mutex.Unlock()
+
+	if old != nil {
+		old.Logout()
+		telemetryReconnections.add(1, []string{"ok"})
+	}
+	if oldTunnel != nil {
+		oldTunnel.close()
+	}
+	return nil
+}
+
+// alive checks if the router in use is still reachable, the probe is written always at the same path
+// and it is removed when the session is closed, the probe of a process that dies is left in the store
+func (s *yaksSession) alive() bool {
+	return s.workspace().Put(s.probe, yaks.NewStringValue(time.Now().UTC().Format(time.RFC3339))) == nil
+}
+
+// notify asks the monitor to check the router, it is called when an operation fails
+func (s *yaksSession) notify() {
+	if s.check == nil {
+		return
+	}
+	select {
+	case s.check <- true:
+	default:
+	}
+}
+
+func (s *yaksSession) monitor() {
+	ticker := time.NewTicker(LocatorCheckInterval)
+	defer ticker.Stop()
+	lastFailback := time.Now()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		case <-s.check:
+		}
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+		if s.alive() {
+			if time.Since(lastFailback) >= LocatorFailbackInterval {
+				lastFailback = time.Now()
+				s.failback()
+			}
+			continue
+		}
+		s.log().WithField("locator", s.activeLocator()).Warn("YAKS router not reachable, failing over")
+		err := s.failover()
+		if err != nil {
+			s.log().Error(err.Error())
+		}
+	}
+}
+
+func (s *yaksSession) close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.done != nil {
+		close(s.done)
+	}
+	if s.client == nil {
+		return nil
+	}
+	if s.probe != nil {
+		s.ws.Remove(s.probe)
+	}
+	err := s.client.Logout()
+	if s.tunnel != nil {
+		s.tunnel.close()
+	}
+	return err
+}
+
+// Get ...
+// YAKS does not report the errors of a get, a get to an unreachable router does not complete: if it lasts
+// more than LocatorCheckInterval the monitor is asked to check the router and the get is counted as an error
+func (s *yaksSession) Get(selector *yaks.Selector) []yaks.Entry {
+	stalled := time.AfterFunc(LocatorCheckInterval, s.notify)
+	res := s.workspace().Get(selector)
+	outcome := "ok"
+	if !stalled.Stop() {
+		outcome = "error"
+	}
+	telemetryOperations.add(1, []string{"get", outcome})
+	return res
+}
+
+// Put ...
+func (s *yaksSession) Put(path *yaks.Path, value yaks.Value) error {
+	a := s.audit()
+	var prev yaks.Value
+	if a != nil && isDesiredPath(path.ToString()) {
+		prev = a.previous(path)
+	} else {
+		a = nil
+	}
+	err := s.workspace().Put(path, value)
+	telemetryOperations.add(1, []string{"put", operationOutcome(err)})
+	if err != nil {
+		s.notify()
+		return err
+	}
+	if a != nil {
+		rec := newAuditRecord(a.actor, AUDITPUT, path.ToString())
+		rec.PreviousHash = auditValueHash(prev)
+		rec.NewHash = auditValueHash(value)
+		s.recordAudit(a, rec)
+	}
+	return nil
+}
+
+// Remove ...
+func (s *yaksSession) Remove(path *yaks.Path) error {
+	a := s.audit()
+	var prev yaks.Value
+	if a != nil && isDesiredPath(path.ToString()) {
+		prev = a.previous(path)
+	} else {
+		a = nil
+	}
+	err := s.workspace().Remove(path)
+	telemetryOperations.add(1, []string{"remove", operationOutcome(err)})
+	if err != nil {
+		s.notify()
+		return err
+	}
+	if a != nil {
+		rec := newAuditRecord(a.actor, AUDITREMOVE, path.ToString())
+		rec.PreviousHash = auditValueHash(prev)
+		s.recordAudit(a, rec)
+	}
+	return nil
+}
+
+// tracing returns the tracer of the session, DefaultTracer if none was set
+func (s *yaksSession) tracing() *Tracer {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.tracer == nil {
+		return DefaultTracer
+	}
+	return s.tracer
+}
+
+// audit returns the auditor of the session, nil if audit is not enabled
+func (s *yaksSession) audit() *Auditor {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.auditor
+}
+
+// recordAudit appends the record to the audit log, a failure does not fail the write being audited
+func (s *yaksSession) recordAudit(a *Auditor, rec AuditRecord) {
+	err := a.record(rec)
+	if err != nil {
+		s.log().WithField("path", rec.Path).Error("Unable to record audit: " + err.Error())
+	}
+}
+
+// Subscribe ...
+func (s *yaksSession) Subscribe(selector *yaks.Selector, listener yaks.Listener) (*yaks.SubscriptionID, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	listener = instrumentListener(listener)
+	sid, err := s.ws.Subscribe(selector, listener)
+	if err != nil {
+		return nil, err
+	}
+	s.subs[sid] = &subscriptionRecord{selector: selector, listener: listener, current: sid}
+	return sid, nil
+}
+
+// Unsubscribe ...
+func (s *yaksSession) Unsubscribe(sid *yaks.SubscriptionID) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	rec, found := s.subs[sid]
+	if !found {
+		return s.ws.Unsubscribe(sid)
+	}
+	delete(s.subs, sid)
+	return s.ws.Unsubscribe(rec.current)
+}
+
+// RegisterEval ...
+func (s *yaksSession) RegisterEval(path *yaks.Path, eval yaks.Eval) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	eval = instrumentEval(path, eval)
+	err := s.ws.RegisterEval(path, eval)
+	if err != nil {
+		return err
+	}
+	s.evals[path.ToString()] = &evalRecord{path: path, eval: eval}
+	return nil
+}
+
+// UnregisterEval ...
+func (s *yaksSession) UnregisterEval(path *yaks.Path) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.evals, path.ToString())
+	return s.ws.UnregisterEval(path)
+}
@@ -9,4 +9,5 @@ require (
 	github.com/kr/pty v1.1.8 // indirect
 	github.com/sirupsen/logrus v1.4.2
 	github.com/stretchr/objx v0.2.0 // indirect
+	gopkg.in/yaml.v2 v2.2.7
 )